@@ -0,0 +1,235 @@
+package neat
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// The serialized form of a neuron gene
+type savedNeuron struct {
+	ID         uint64 `json:"ID"`
+	Innovation uint64 `json:"Innovation"`
+	Kind       int    `json:"Kind"`
+	Locked     bool   `json:"Locked,omitempty"`
+	Regulated  bool   `json:"Regulated,omitempty"`
+}
+
+// The serialized form of a synapse gene
+type savedSynapse struct {
+	ID         uint64  `json:"ID"`
+	In         uint64  `json:"In"`
+	Out        uint64  `json:"Out"`
+	Weight     float64 `json:"Weight"`
+	Enabled    bool    `json:"Enabled"`
+	Innovation uint64  `json:"Innovation"`
+	Locked     bool    `json:"Locked,omitempty"`
+}
+
+// The serialized form of a gene, exactly one of the fields is set
+type savedGene struct {
+	Neuron  *savedNeuron  `json:"Neuron,omitempty"`
+	Synapse *savedSynapse `json:"Synapse,omitempty"`
+}
+
+// The serialized form of an organism
+type savedOrganism struct {
+	ID         uint64      `json:"ID"`
+	Generation int         `json:"Generation"`
+	Fitness    float64     `json:"Fitness"`
+	Age        int         `json:"Age"`
+	Species    uint64      `json:"Species"`
+	Genes      []savedGene `json:"Genes"`
+}
+
+// The serialized form of a population
+type savedPopulation struct {
+	Inputs     int             `json:"Inputs"`
+	Outputs    int             `json:"Outputs"`
+	Generation int             `json:"Generation"`
+	Organisms  []savedOrganism `json:"Organisms"`
+
+	// The global counters at the time of saving, new genes created after
+	// loading must not reuse innovation numbers or ids
+	InnovationCount uint64 `json:"InnovationCount"`
+	IDCount         uint64 `json:"IDCount"`
+}
+
+// The serialized form of an organism. Custom genes can't be serialized,
+// organisms with custom genes are an error rather than saved without them.
+func saveOrganism(org *organism) (savedOrganism, error) {
+	saved := savedOrganism{
+		ID:         org.id,
+		Generation: org.generation,
+		Fitness:    org.fitness,
+		Age:        org.age,
+		Species:    org.species,
+		Genes:      make([]savedGene, 0, len(org.genes)),
+	}
+
+	// The genes are saved in gene order, the order they must be added in
+	// when the organism is loaded
+	for _, g := range org.genes {
+		switch g := g.(type) {
+		case *neuron:
+			saved.Genes = append(saved.Genes, savedGene{Neuron: &savedNeuron{
+				ID:         uint64(g.id),
+				Innovation: g.innovation,
+				Kind:       int(g.kind),
+				Locked:     g.locked,
+				Regulated:  g.regulated,
+			}})
+		case *synapse:
+			saved.Genes = append(saved.Genes, savedGene{Synapse: &savedSynapse{
+				ID:         uint64(g.id),
+				In:         uint64(g.in),
+				Out:        uint64(g.out),
+				Weight:     g.weight,
+				Enabled:    g.enabled,
+				Innovation: g.innovation,
+				Locked:     g.locked,
+			}})
+		default:
+			return savedOrganism{}, errors.New("Custom genes can't be saved")
+		}
+	}
+
+	return saved, nil
+}
+
+func loadOrganism(saved savedOrganism, nInputs, nOutputs int) (*organism, error) {
+	org := _newOrganism(nInputs, nOutputs)
+	org.id = saved.ID
+	org.generation = saved.Generation
+	org.fitness = saved.Fitness
+	org.age = saved.Age
+	org.species = saved.Species
+
+	for _, g := range saved.Genes {
+		switch {
+		case g.Neuron != nil:
+			org.addNeuron(&neuron{
+				id:         neuronID(g.Neuron.ID),
+				innovation: g.Neuron.Innovation,
+				kind:       neuronKind(g.Neuron.Kind),
+				locked:     g.Neuron.Locked,
+				regulated:  g.Neuron.Regulated,
+			})
+		case g.Synapse != nil:
+			in := neuronID(g.Synapse.In)
+			out := neuronID(g.Synapse.Out)
+			if org.neurons[in] == nil || org.neurons[out] == nil {
+				return nil, errors.New("Synapse references an unknown neuron")
+			}
+
+			org.addSynapse(&synapse{
+				id:         synapseID(g.Synapse.ID),
+				in:         in,
+				out:        out,
+				weight:     g.Synapse.Weight,
+				enabled:    g.Synapse.Enabled,
+				innovation: g.Synapse.Innovation,
+				locked:     g.Synapse.Locked,
+			})
+		default:
+			return nil, errors.New("Empty gene")
+		}
+	}
+
+	if len(org.sensors) != nInputs || len(org.outputs) != nOutputs {
+		return nil, errors.New("Organism doesn't match the population's inputs and outputs")
+	}
+
+	return org, nil
+}
+
+// Make sure the global counters are at least at the given values
+func advanceCounters(innovation, id uint64) {
+	for current := innovationCount.Load(); current < innovation; current = innovationCount.Load() {
+		innovationCount.CompareAndSwap(current, innovation)
+	}
+
+	for current := idCount.Load(); current < id; current = idCount.Load() {
+		idCount.CompareAndSwap(current, id)
+	}
+}
+
+// Save the population to a file. The output only depends on the
+// population, the same population always gives the same bytes. Fails if an
+// organism has custom genes.
+func (p *Population) Save(path string) error {
+	saved := savedPopulation{
+		Inputs:          p.nInputs,
+		Outputs:         p.nOutputs,
+		Generation:      p.generation,
+		Organisms:       make([]savedOrganism, len(p.organisms)),
+		InnovationCount: innovationCount.Load(),
+		IDCount:         idCount.Load(),
+	}
+
+	for i, org := range p.organisms {
+		o, err := saveOrganism(org)
+		if err != nil {
+			return err
+		}
+		saved.Organisms[i] = o
+	}
+
+	raw, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash while saving doesn't
+	// destroy the previous checkpoint
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Load a population saved by Population.Save and make the configuration
+// the global configuration
+func LoadPopulationFromCheckpoint(path string, cfg NeatConfig) (*Population, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved savedPopulation
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return nil, err
+	}
+
+	SetNeatConfig(cfg)
+	advanceCounters(saved.InnovationCount, saved.IDCount)
+
+	organisms := make([]*organism, len(saved.Organisms))
+	for i, s := range saved.Organisms {
+		org, err := loadOrganism(s, saved.Inputs, saved.Outputs)
+		if err != nil {
+			return nil, err
+		}
+		organisms[i] = org
+	}
+
+	p := newPopulationFrom(saved.Inputs, saved.Outputs, organisms)
+	p.generation = saved.Generation
+
+	// Rebuild the species from the species ids of the organisms
+	bySpecies := make(map[uint64]*Species)
+	for _, org := range organisms {
+		if s, ok := bySpecies[org.species]; ok {
+			s.add(org)
+		} else {
+			s := &Species{id: org.species}
+			s.add(org)
+			bySpecies[org.species] = s
+			p.species = append(p.species, s)
+		}
+	}
+
+	return p, nil
+}
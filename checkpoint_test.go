@@ -0,0 +1,93 @@
+package neat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+	})
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	population := NewPopulation(2, 1, PopulationOptions{
+		CheckpointEvery: 3,
+		CheckpointPath:  path,
+	})
+
+	eval := func(org *organism) float64 {
+		return org.process([]float64{1, 1})[0]
+	}
+
+	for generation := 1; generation <= 6; generation++ {
+		population.Step(eval)
+
+		_, err := os.Stat(path)
+		if generation < 3 {
+			require.True(t, os.IsNotExist(err), "")
+			continue
+		}
+		require.NoError(t, err, "")
+
+		loaded, err := LoadPopulationFromCheckpoint(path, testConfig)
+		require.NoError(t, err, "")
+		require.Equal(t, generation/3*3, loaded.Generation(), "")
+	}
+
+	loaded, err := LoadPopulationFromCheckpoint(path, testConfig)
+	require.NoError(t, err, "")
+	require.Equal(t, 6, loaded.Generation(), "")
+	require.Equal(t, len(population.organisms), len(loaded.organisms), "")
+
+	// The loaded organisms are identical to the saved ones
+	for i, org := range population.organisms {
+		saved, err := saveOrganism(org)
+		require.NoError(t, err, "")
+		reloaded, err := saveOrganism(loaded.organisms[i])
+		require.NoError(t, err, "")
+		require.Equal(t, saved, reloaded, "")
+	}
+
+	// and the loaded population can continue to evolve
+	loaded.Step(eval)
+	require.Equal(t, 7, loaded.Generation(), "")
+
+	// Custom genes can't be saved
+	population.organisms[0].AddCustomGene(&gainGene{NextInnovation(), 2})
+	require.Error(t, population.Save(path), "")
+	_, err = saveOrganism(population.organisms[0])
+	require.Error(t, err, "")
+}
+
+func TestCheckpointIsReproducible(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0.2
+		c.OrganismConfig.SynapseAddMutProb = 0.5
+		c.PopulationConfig.Size = 10
+	})
+
+	population := NewPopulation(2, 1, PopulationOptions{})
+	for i := 0; i < 5; i++ {
+		population.Step(func(org *organism) float64 { return float64(len(org.genes)) })
+	}
+
+	// The same population saved twice gives the same bytes, the genes
+	// are written in gene order and never in map order
+	dir := t.TempDir()
+	var saved [][]byte
+	for _, name := range []string{"a.json", "b.json"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, population.Save(path), "")
+
+		raw, err := os.ReadFile(path)
+		require.NoError(t, err, "")
+		saved = append(saved, raw)
+	}
+	require.Equal(t, saved[0], saved[1], "")
+}
@@ -0,0 +1,40 @@
+package neat
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The interfaces the types are expected to implement, checked when the
+// tests are compiled
+var (
+	_ gene         = &neuron{}
+	_ gene         = &synapse{}
+	_ fmt.Stringer = &organism{}
+	_ Queue        = newsqueue()
+)
+
+func TestOrganismString(t *testing.T) {
+	org := newOrganism(2, 1)
+	org.fitness = 0.5
+
+	expected := fmt.Sprintf("organism %d (generation 0, fitness 0.5, 3 neurons, 2 synapses)", org.id)
+	require.Equal(t, expected, org.String(), "")
+}
+
+// Neuron and synapse ids are distinct types, see ids_mixing_test.go for
+// the code that is rejected by the compiler
+func TestIDTypes(t *testing.T) {
+	neuronType := reflect.TypeOf(neuronID(0))
+	synapseType := reflect.TypeOf(synapseID(0))
+
+	require.False(t, neuronType.AssignableTo(synapseType), "")
+	require.False(t, synapseType.AssignableTo(neuronType), "")
+
+	// The receiver is the first argument of a method expression
+	require.Equal(t, neuronType, reflect.TypeOf((*organism).getNeuron).In(1), "")
+	require.Equal(t, synapseType, reflect.TypeOf((*organism).getSynapse).In(1), "")
+}
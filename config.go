@@ -3,8 +3,9 @@ package neat
 import (
 	"errors"
 	"encoding/json"
+	"io"
 	"math"
-	"io/ioutil"
+	"os"
 )
 
 var ErrIllegalProbability = errors.New("probability is not in range [0, 1]")
@@ -27,12 +28,70 @@ func Rectifier(x float64) float64 {
 	return math.Max(0, x)
 }
 
+// The absolute value, folds the input around zero
+func Abs(x float64) float64 {
+	return math.Abs(x)
+}
+
+// The identity function clamped to [-1, 1]
+func ClampedLinear(x float64) float64 {
+	return math.Max(-1, math.Min(1, x))
+}
+
+// The exponential linear unit with alpha 1, x for x >= 0 and
+// alpha * (exp(x) - 1) otherwise
+func ELU(x float64) float64 {
+	return elu(1, x)
+}
+
+// The exponential linear unit with the given alpha
+func NewELU(alpha float64) ActivationFunction {
+	return func(x float64) float64 {
+		return elu(alpha, x)
+	}
+}
+
+func elu(alpha, x float64) float64 {
+	if x >= 0 {
+		return x
+	}
+
+	return alpha * math.Expm1(x)
+}
+
+// The swish function, x * Sigmoid(x). The sigmoid is computed without
+// overflowing for inputs of large magnitude.
+func Swish(x float64) float64 {
+	if x >= 0 {
+		return x / (1 + math.Exp(-x))
+	}
+
+	expX := math.Exp(x)
+	return x * expX / (1 + expX)
+}
+
 var actFuncNameMap = map[string]ActivationFunction{
 	"Sigmoid": Sigmoid,
 	"FastSigmoid": FastSigmoid,
 	"Recifier": Rectifier,
+	"Abs": Abs,
+	"Clamped": ClampedLinear,
+	"ELU": ELU,
+	"Swish": Swish,
 }
 
+// The strategies for picking the representative of a species
+const (
+	// The organism that was added to the species first
+	RepresentativeFirst = "first"
+
+	// A member picked at random
+	RepresentativeRandom = "random"
+
+	// The fittest member
+	RepresentativeChampion = "champion"
+)
+
 type SpeciesConfig struct {
 	/*
 	// When a organism evolves a new topology it may need to be treated as a
@@ -68,11 +127,28 @@ type SpeciesConfig struct {
 	DisjoinGenesCoeff float64 `json:"DisjoinGenesCoeff"`
 
 	// Average weight diff coefficient
-	AvgWeightDiffCoeff float64 `json:"AvgWeightDiffCoeff "`
+	AvgWeightDiffCoeff float64 `json:"AvgWeightDiffCoeff"`
 
 	// The compatibility threshold, i.e. the maximum genetic distance
 	// separating two organisms before speciation occurs.
 	CompatibilityThreshold float64 `json:"CompatibilityThreshold"`
+
+	// How the representative that organisms are compared against is picked
+	// among the members of a species, defaults to the first member
+	RepresentativeStrategy string `json:"RepresentativeStrategy"`
+
+	// A fixed number of species. When set, organisms are assigned to the
+	// nearest of SpeciesCount representatives instead of being compared
+	// against the compatibility threshold, zero disables it
+	SpeciesCount int `json:"SpeciesCount"`
+
+	// Scale the compatibility threshold of every species by
+	// TargetSpeciesSize / size, large species become harder to join and
+	// small ones easier
+	PerSpeciesThreshold bool `json:"PerSpeciesThreshold"`
+
+	// The species size at which the threshold is unscaled
+	TargetSpeciesSize int `json:"TargetSpeciesSize"`
 }
 
 type OrganismConfig struct {
@@ -82,38 +158,256 @@ type OrganismConfig struct {
 	// The probability that a synapse's activity toggle is switched
 	SynapseActivityMutProb float64 `json:"SynapseActivityMutProb"`
 
-	// The probability that a synapse's weight is perturbed
-	SynapseWeightMutProp float64 `json:"SynapseWeightMutProp"`
+	// The probability that a synapse's weight is perturbed. Configurations
+	// using the deprecated name SynapseWeightMutProp are still read.
+	SynapseWeightMutProb float64 `json:"SynapseWeightMutProb"`
 
 	// The absolute bound of a weight mutation (rand-number * bound)
 	SynapseWeightBound float64 `json:"SynapseWeightBound"`
 
+	// The probability that a new synapse is added between two unconnected
+	// neurons
+	SynapseAddMutProb float64 `json:"SynapseAddMutProb"`
+
+	// The maximum ratio of enabled synapses to possible synapses, synapses
+	// are not added beyond this density. Zero means no limit.
+	MaxConnectionDensity float64 `json:"MaxConnectionDensity"`
+
+	// The maximum number of neurons and synapses, disabled synapses
+	// included, in a genome. Splits and new connections that would exceed
+	// them don't happen. Zero means no cap.
+	MaxNeurons  int `json:"MaxNeurons"`
+	MaxSynapses int `json:"MaxSynapses"`
+
+	// The probability that a sensor is connected to an output in the
+	// initial population, every output gets at least one synapse. Zero
+	// means the minimal topology.
+	InitialConnectProb float64 `json:"InitialConnectProb"`
+
+	// The standard deviation of the shared scale when the incoming weights
+	// of a neuron are mutated together. With probability
+	// SynapseWeightMutProb every incoming weight of a neuron is multiplied
+	// by the same factor 1 + N(0, CorrelatedWeightMutation) instead of the
+	// weights being mutated one by one. Zero means independent mutation.
+	CorrelatedWeightMutation float64 `json:"CorrelatedWeightMutation"`
+
+	// The probability that the regulation of a random hidden neuron is
+	// toggled, silencing or expressing it
+	RegulationMutProb float64 `json:"RegulationMutProb"`
+
+	// The number of steps of hill-climbing on the weights of every
+	// offspring after it is evaluated, in every DiversityMode, see
+	// HillClimbWeights. Zero disables it.
+	PostMatingHillClimbSteps int `json:"PostMatingHillClimbSteps"`
+
+	// Clamp the input sum of every neuron to [-SumClamp, SumClamp] before
+	// it is activated, keeping positive feedback in recurrent networks
+	// from growing without bound. Zero means no clamp.
+	SumClamp float64 `json:"SumClamp"`
+
+	// The learning rate of the Hebbian training in CrossValidationEval,
+	// zero uses a rate of 0.01
+	HebbianLearningRate float64 `json:"HebbianLearningRate"`
+
+	// Normalize the weights of every offspring so that the largest
+	// absolute weight equals SynapseWeightBound
+	NormalizeWeightsAfterMating bool `json:"NormalizeWeightsAfterMating"`
+
+	// Every MutationDecayInterval generations the mutation probabilities
+	// are multiplied by 1 - MutationDecayRate, moving from exploration to
+	// exploitation like the temperature in simulated annealing. A zero
+	// rate or interval disables the decay.
+	MutationDecayRate     float64 `json:"MutationDecayRate"`
+	MutationDecayInterval int     `json:"MutationDecayInterval"`
+
+	// The decay never lowers a mutation probability below this value
+	MinMutationRate float64 `json:"MinMutationRate"`
+
 	// Neuron activation function
 	ActFunc string `json:"ActFunc"`
 
-	actFunc ActivationFunction
+	// The activation function of the output neurons, e.g. Sigmoid for
+	// classification while the hidden neurons use a Rectifier. Empty means
+	// the outputs use ActFunc as well.
+	OutputActFunc string `json:"OutputActFunc"`
+
+	actFunc       ActivationFunction
+	outputActFunc ActivationFunction
+}
+
+// Look up the activation functions by name unless they are already set
+func (c *OrganismConfig) resolveActFuncs() {
+	if c.actFunc == nil {
+		c.actFunc = actFuncNameMap[c.ActFunc]
+	}
+	if c.outputActFunc == nil && c.OutputActFunc != "" {
+		c.outputActFunc = actFuncNameMap[c.OutputActFunc]
+	}
+}
+
+// Decode the configuration and look up the activation functions for the
+// decoded names, so that a decoded configuration is ready to use
+func (c *OrganismConfig) UnmarshalJSON(data []byte) error {
+	// The plain type has no methods, decoding it doesn't recurse. The
+	// weight mutation probability is decoded apart from it to accept its
+	// deprecated name.
+	type plain OrganismConfig
+	decoded := struct {
+		*plain
+		SynapseWeightMutProb *float64 `json:"SynapseWeightMutProb"`
+		SynapseWeightMutProp *float64 `json:"SynapseWeightMutProp"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	switch {
+	case decoded.SynapseWeightMutProb != nil:
+		c.SynapseWeightMutProb = *decoded.SynapseWeightMutProb
+	case decoded.SynapseWeightMutProp != nil:
+		logf("SynapseWeightMutProp is deprecated, use SynapseWeightMutProb")
+		c.SynapseWeightMutProb = *decoded.SynapseWeightMutProp
+	}
+
+	c.actFunc, c.outputActFunc = nil, nil
+	c.resolveActFuncs()
+
+	return nil
+}
+
+// The activation function of a kind of neuron
+func (c *OrganismConfig) activation(kind neuronKind) ActivationFunction {
+	if kind == outputNeuron && c.outputActFunc != nil {
+		return c.outputActFunc
+	}
+
+	return c.actFunc
+}
+
+// The name of the activation function of a kind of neuron
+func (c *OrganismConfig) activationName(kind neuronKind) string {
+	if kind == outputNeuron && c.OutputActFunc != "" {
+		return c.OutputActFunc
+	}
+
+	return c.ActFunc
+}
+
+// The mechanisms available for maintaining diversity in a population
+const (
+	// The fittest organism survives and the rest of the population is
+	// replaced by offspring
+	DiversityElitism = "Elitism"
+
+	// Deterministic crowding, an offspring replaces its most similar parent
+	// if it is fitter
+	DiversityCrowding = "Crowding"
+
+	// Age-fitness Pareto optimization, the survivors are the organisms that
+	// no other organism beats in both fitness and age. A new random
+	// organism enters the population every generation.
+	DiversityAFPO = "AFPO"
+)
+
+// How the fitnesses of the trials of an organism are combined
+const (
+	// The mean fitness of the trials
+	TrialsMean = "mean"
+
+	// The lowest fitness of the trials, rewarding organisms that do well
+	// every time
+	TrialsMin = "min"
+)
+
+// The transforms from raw rewards to positive fitnesses
+const (
+	// exp(raw), stretches the differences between high rewards
+	FitnessTransformExp = "exp"
+
+	// log(1 + exp(raw)), close to the raw reward for positive rewards
+	FitnessTransformSoftplus = "softplus"
+)
+
+type PopulationConfig struct {
+	// The number of organisms in the population
+	Size int `json:"Size"`
+
+	// The mechanism used for maintaining diversity, defaults to elitism
+	DiversityMode string `json:"DiversityMode"`
+
+	// Lamarckian local search. When enabled the weights of the fittest
+	// organisms are tuned by hill-climbing after evaluation and the tuned
+	// weights are written back into their genomes.
+	LocalSearch bool `json:"LocalSearch"`
+
+	// The number of hill-climbing passes over the weights of an organism
+	LocalSearchSteps int `json:"LocalSearchSteps"`
+
+	// The number of organisms, the fittest ones, that are tuned
+	LocalSearchOrganisms int `json:"LocalSearchOrganisms"`
+
+	// Keep an archive of the organisms that are non-dominated in the
+	// population's objectives, see Population.Objectives
+	MultiObjective bool `json:"MultiObjective"`
+
+	// The number of fresh minimal organisms that replace the least fit
+	// organisms every generation
+	RandomInjectionCount int `json:"RandomInjectionCount"`
+
+	// The number of fittest organisms across the whole population that are
+	// copied unchanged into the next generation when reproducing with
+	// elitism, regardless of their species. Zero keeps only the champion.
+	PopulationElitism int `json:"PopulationElitism"`
+
+	// The number of times every organism is evaluated, starting out at
+	// rest every time, its fitness combines the trials as set by
+	// FitnessTrialAggregation. Zero or one evaluates each organism once.
+	FitnessEvalTrials int `json:"FitnessEvalTrials"`
+
+	// How the trials are combined, defaults to the mean
+	FitnessTrialAggregation string `json:"FitnessTrialAggregation"`
+
+	// Transform the fitness function's raw rewards with PositiveFitness
+	// before they are used, for fitness functions that return signed
+	// rewards. Empty uses the raw rewards.
+	FitnessTransform string `json:"FitnessTransform"`
 }
 
 type NeatConfig struct {
 	SpeciesConfig SpeciesConfig `json:"SpeciesConfig"`
 	OrganismConfig OrganismConfig `json:"OrganismConfig"`
+	PopulationConfig PopulationConfig `json:"PopulationConfig"`
 }
 
 func validateSpeciesConfig(c SpeciesConfig) error {
 	if c.ExcessGenesCoeff < 0 {
-		errors.New("ExcessGeneCoeff must be positive")
+		return errors.New("ExcessGeneCoeff must be positive")
 	}
 
 	if c.DisjoinGenesCoeff < 0 {
-		errors.New("DisjoinGenesCoeff must be positive")
+		return errors.New("DisjoinGenesCoeff must be positive")
 	}
 
 	if c.AvgWeightDiffCoeff <0 {
-		errors.New("AvgWeightDiffCoeff must be positive")
+		return errors.New("AvgWeightDiffCoeff must be positive")
 	}
 
 	if c.CompatibilityThreshold < 0 {
-		errors.New("CompatibilityThreshold must be positive")
+		return errors.New("CompatibilityThreshold must be positive")
+	}
+
+	switch c.RepresentativeStrategy {
+	case "", RepresentativeFirst, RepresentativeRandom, RepresentativeChampion:
+	default:
+		return errors.New("Unknown representative strategy: " + c.RepresentativeStrategy)
+	}
+
+	if c.SpeciesCount < 0 {
+		return errors.New("SpeciesCount must be positive")
+	}
+
+	if c.TargetSpeciesSize < 0 {
+		return errors.New("TargetSpeciesSize must be positive")
 	}
 
 	return nil
@@ -128,18 +422,120 @@ func validateOrganismConfig(c OrganismConfig) error {
 		return errors.New("SynapseActivityMutProb must be in the range [0, 1]")
 	}
 
-	if !inRange(c.SynapseWeightMutProp, 0.0, 1.0) {
-		return errors.New("SynapseWeightMutProp must be in the range [0, 1]")
+	if !inRange(c.SynapseWeightMutProb, 0.0, 1.0) {
+		return errors.New("SynapseWeightMutProb must be in the range [0, 1]")
 	}
 
 	if c.SynapseWeightBound <= 0 {
 		return errors.New("SynapseWeightBound must be larger than zero")
 	}
 
+	if !inRange(c.SynapseAddMutProb, 0.0, 1.0) {
+		return errors.New("SynapseAddMutProb must be in the range [0, 1]")
+	}
+
+	if !inRange(c.MaxConnectionDensity, 0.0, 1.0) {
+		return errors.New("MaxConnectionDensity must be in the range [0, 1]")
+	}
+
+	if c.MaxNeurons < 0 {
+		return errors.New("MaxNeurons must be positive")
+	}
+
+	if c.MaxSynapses < 0 {
+		return errors.New("MaxSynapses must be positive")
+	}
+
+	if c.CorrelatedWeightMutation < 0 {
+		return errors.New("CorrelatedWeightMutation must not be negative")
+	}
+
+	if !inRange(c.RegulationMutProb, 0.0, 1.0) {
+		return errors.New("RegulationMutProb must be in the range [0, 1]")
+	}
+
+	if c.PostMatingHillClimbSteps < 0 {
+		return errors.New("PostMatingHillClimbSteps must be positive")
+	}
+
+	if c.SumClamp < 0 {
+		return errors.New("SumClamp must be positive")
+	}
+
+	if c.HebbianLearningRate < 0 {
+		return errors.New("HebbianLearningRate must be positive")
+	}
+
+	if !inRange(c.InitialConnectProb, 0.0, 1.0) {
+		return errors.New("InitialConnectProb must be in the range [0, 1]")
+	}
+
+	if !inRange(c.MutationDecayRate, 0.0, 1.0) {
+		return errors.New("MutationDecayRate must be in the range [0, 1]")
+	}
+
+	if c.MutationDecayInterval < 0 {
+		return errors.New("MutationDecayInterval must be positive")
+	}
+
+	if !inRange(c.MinMutationRate, 0.0, 1.0) {
+		return errors.New("MinMutationRate must be in the range [0, 1]")
+	}
+
 	if _, ok := actFuncNameMap[c.ActFunc]; !ok {
 		return errors.New("Unregistered activation function: " + c.ActFunc)
 	}
 
+	if _, ok := actFuncNameMap[c.OutputActFunc]; !ok && c.OutputActFunc != "" {
+		return errors.New("Unregistered output activation function: " + c.OutputActFunc)
+	}
+
+	return nil
+}
+
+func validatePopulationConfig(c PopulationConfig) error {
+	if c.Size < 0 {
+		return errors.New("Size must be positive")
+	}
+
+	switch c.DiversityMode {
+	case "", DiversityElitism, DiversityCrowding, DiversityAFPO:
+	default:
+		return errors.New("Unknown diversity mode: " + c.DiversityMode)
+	}
+
+	if c.LocalSearchSteps < 0 {
+		return errors.New("LocalSearchSteps must be positive")
+	}
+
+	if c.LocalSearchOrganisms < 0 {
+		return errors.New("LocalSearchOrganisms must be positive")
+	}
+
+	if c.RandomInjectionCount < 0 {
+		return errors.New("RandomInjectionCount must be positive")
+	}
+
+	if c.PopulationElitism < 0 {
+		return errors.New("PopulationElitism must be positive")
+	}
+
+	if c.FitnessEvalTrials < 0 {
+		return errors.New("FitnessEvalTrials must be positive")
+	}
+
+	switch c.FitnessTrialAggregation {
+	case "", TrialsMean, TrialsMin:
+	default:
+		return errors.New("Unknown trial aggregation: " + c.FitnessTrialAggregation)
+	}
+
+	switch c.FitnessTransform {
+	case "", FitnessTransformExp, FitnessTransformSoftplus:
+	default:
+		return errors.New("Unknown fitness transform: " + c.FitnessTransform)
+	}
+
 	return nil
 }
 
@@ -152,21 +548,36 @@ func validateNeatConfig(c NeatConfig) error {
 		return err
 	}
 
+	if err := validatePopulationConfig(c.PopulationConfig); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func ReadConfig(path string) (*NeatConfig, error) {
-	raw, err := ioutil.ReadFile(path)
-	if err != nil {
+// Read and validate a JSON configuration from a reader, e.g. os.Stdin. The
+// activation functions are looked up by name. Deprecated settings are
+// accepted with a warning on the package Logger.
+func ReadConfigReader(r io.Reader) (*NeatConfig, error) {
+	var config NeatConfig
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
 		return nil, err
 	}
 
-	var config NeatConfig
-	err = json.Unmarshal(raw, &config)
+	if err := validateNeatConfig(config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
 
-	if err = validateNeatConfig(config); err != nil {
+// Read and validate a JSON configuration file
+func ReadConfig(path string) (*NeatConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
 		return nil, err
 	}
-	
-	return &config, err
+	defer file.Close()
+
+	return ReadConfigReader(file)
 }
@@ -0,0 +1,193 @@
+package neat
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigJSON = `{
+	"SpeciesConfig": {
+		"ExcessGenesCoeff": 1.0,
+		"DisjoinGenesCoeff": 1.5,
+		"AvgWeightDiffCoeff": 0.4,
+		"CompatibilityThreshold": 3.0
+	},
+	"OrganismConfig": {
+		"SynapseSplitMutProb": 0.03,
+		"SynapseActivityMutProb": 0.01,
+		"SynapseWeightMutProb": 0.8,
+		"SynapseWeightBound": 2.5,
+		"ActFunc": "Sigmoid"
+	}
+}`
+
+func TestReadConfigReader(t *testing.T) {
+	config, err := ReadConfigReader(strings.NewReader(testConfigJSON))
+	require.NoError(t, err, "")
+
+	require.NoError(t, validateNeatConfig(*config), "")
+
+	require.Equal(t, 1.0, config.SpeciesConfig.ExcessGenesCoeff, "")
+	require.Equal(t, 1.5, config.SpeciesConfig.DisjoinGenesCoeff, "")
+	require.Equal(t, 0.4, config.SpeciesConfig.AvgWeightDiffCoeff, "")
+	require.Equal(t, 3.0, config.SpeciesConfig.CompatibilityThreshold, "")
+
+	require.Equal(t, 0.03, config.OrganismConfig.SynapseSplitMutProb, "")
+	require.Equal(t, 0.01, config.OrganismConfig.SynapseActivityMutProb, "")
+	require.Equal(t, 0.8, config.OrganismConfig.SynapseWeightMutProb, "")
+	require.Equal(t, 2.5, config.OrganismConfig.SynapseWeightBound, "")
+	require.Equal(t, "Sigmoid", config.OrganismConfig.ActFunc, "")
+}
+
+func TestReadConfigReaderActFunc(t *testing.T) {
+	same := func(a, b ActivationFunction) bool {
+		return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	}
+
+	cfg, err := ReadConfigReader(strings.NewReader(testConfigJSON))
+	require.NoError(t, err, "")
+	require.NotNil(t, cfg.OrganismConfig.actFunc, "")
+	require.True(t, same(Sigmoid, cfg.OrganismConfig.actFunc), "")
+	require.Nil(t, cfg.OrganismConfig.outputActFunc, "")
+
+	// A round trip through JSON resolves the names again
+	cfg.OrganismConfig.ActFunc = "Swish"
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err, "")
+
+	var decoded NeatConfig
+	require.NoError(t, json.Unmarshal(data, &decoded), "")
+	require.True(t, same(Swish, decoded.OrganismConfig.actFunc), "")
+
+	// and so does setting the global configuration
+	withConfig(t, func(*NeatConfig) {})
+	SetNeatConfig(NeatConfig{OrganismConfig: OrganismConfig{ActFunc: "Sigmoid"}})
+	require.True(t, same(Sigmoid, config.OrganismConfig.actFunc), "")
+}
+
+func TestReadConfigReaderDeprecatedNames(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	old := strings.Replace(testConfigJSON, `"SynapseWeightMutProb"`, `"SynapseWeightMutProp"`, 1)
+	cfg, err := ReadConfigReader(strings.NewReader(old))
+	require.NoError(t, err, "")
+	require.Equal(t, 0.8, cfg.OrganismConfig.SynapseWeightMutProb, "")
+	require.True(t, strings.Contains(logged.String(), "SynapseWeightMutProp is deprecated"), "")
+
+	// The warning goes to the logger of a population once there is one
+	var stats bytes.Buffer
+	t.Cleanup(func() { Logger = nil })
+	withConfig(t, func(c *NeatConfig) { c.PopulationConfig.Size = 1 })
+	NewPopulation(1, 1, PopulationOptions{Logger: log.New(&stats, "", 0)})
+	logged.Reset()
+	_, err = ReadConfigReader(strings.NewReader(old))
+	require.NoError(t, err, "")
+	require.True(t, strings.Contains(stats.String(), "SynapseWeightMutProp is deprecated"), "")
+	require.Equal(t, "", logged.String(), "")
+
+	// The new name wins when both are given
+	both := strings.Replace(testConfigJSON, `"SynapseWeightMutProb": 0.8,`,
+		`"SynapseWeightMutProb": 0.8, "SynapseWeightMutProp": 0.2,`, 1)
+	cfg, err = ReadConfigReader(strings.NewReader(both))
+	require.NoError(t, err, "")
+	require.Equal(t, 0.8, cfg.OrganismConfig.SynapseWeightMutProb, "")
+
+	// Configurations are written with the new name
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err, "")
+	require.True(t, strings.Contains(string(data), `"SynapseWeightMutProb":0.8`), "")
+	require.False(t, strings.Contains(string(data), "SynapseWeightMutProp"), "")
+}
+
+func TestReadConfigReaderInvalid(t *testing.T) {
+	_, err := ReadConfigReader(strings.NewReader("{"))
+	require.Error(t, err, "")
+
+	invalid := strings.Replace(testConfigJSON, `"Sigmoid"`, `"NoSuchFunction"`, 1)
+	_, err = ReadConfigReader(strings.NewReader(invalid))
+	require.Error(t, err, "")
+}
+
+func TestAbs(t *testing.T) {
+	require.Equal(t, 0.0, Abs(0), "")
+	require.Equal(t, 1.5, Abs(-1.5), "")
+	require.Equal(t, 1.5, Abs(1.5), "")
+}
+
+func TestELU(t *testing.T) {
+	require.Equal(t, 0.0, ELU(0), "")
+	require.Equal(t, 2.5, ELU(2.5), "")
+	require.InDelta(t, math.Exp(-1)-1, ELU(-1), 1e-12, "")
+	require.Equal(t, 1e300, ELU(1e300), "")
+
+	// Approaches -alpha for large negative inputs
+	require.InDelta(t, -1.0, ELU(-50), 1e-12, "")
+	require.Equal(t, -1.0, ELU(-1e300), "")
+	require.InDelta(t, -0.5, NewELU(0.5)(-1e300), 1e-12, "")
+}
+
+func TestSwish(t *testing.T) {
+	require.Equal(t, 0.0, Swish(0), "")
+	require.InDelta(t, 1*Sigmoid(1), Swish(1), 1e-12, "")
+	require.InDelta(t, -1*Sigmoid(-1), Swish(-1), 1e-12, "")
+
+	// No overflow for large magnitudes
+	require.Equal(t, 1000.0, Swish(1000), "")
+	require.Equal(t, 0.0, Swish(-1000), "")
+	require.False(t, math.IsNaN(Swish(math.MaxFloat64)), "")
+
+	// Smooth around zero, the slope is 1/2
+	const h = 1e-6
+	require.InDelta(t, 0.5, (Swish(h)-Swish(-h))/(2*h), 1e-6, "")
+	require.InDelta(t, Swish(h)-Swish(0), Swish(0)-Swish(-h), 1e-9, "")
+}
+
+func TestClampedLinear(t *testing.T) {
+	require.Equal(t, 0.5, ClampedLinear(0.5), "")
+	require.Equal(t, 1.0, ClampedLinear(1), "")
+	require.Equal(t, 1.0, ClampedLinear(3), "")
+	require.Equal(t, -1.0, ClampedLinear(-1), "")
+	require.Equal(t, -1.0, ClampedLinear(-3), "")
+}
+
+func TestReadConfigReaderCPPNFunctions(t *testing.T) {
+	for _, name := range []string{"Abs", "Clamped"} {
+		c := strings.Replace(testConfigJSON, `"Sigmoid"`, `"`+name+`"`, 1)
+		config, err := ReadConfigReader(strings.NewReader(c))
+		require.NoError(t, err, "")
+		require.Equal(t, name, config.OrganismConfig.ActFunc, "")
+	}
+}
+
+func TestOutputActFunc(t *testing.T) {
+	c := OrganismConfig{ActFunc: "Recifier", OutputActFunc: "Sigmoid"}
+	c.resolveActFuncs()
+	withConfig(t, func(nc *NeatConfig) { nc.OrganismConfig = c })
+
+	// sensor -> hidden -> output, the hidden neuron receives -2
+	org := newOrganism(1, 1)
+	org.splitSynapse(org.connections[org.sensors[0]][0])
+	hidden := org.genes[len(org.genes)-3].(*neuron).id
+	org.synapses[org.connections[org.sensors[0]][1]].weight = -1
+
+	require.Equal(t, []float64{0.5}, org.process([]float64{2}), "")
+	require.Equal(t, 0.0, org.state(hidden).value, "")
+	require.Equal(t, 2.0, org.state(org.sensors[0]).value, "")
+	require.Equal(t, []float64{0.5}, org.processFeedforward([]float64{2}), "")
+
+	// Without an output activation function the outputs use ActFunc
+	c.OutputActFunc, c.outputActFunc = "", nil
+	c.resolveActFuncs()
+	withConfig(t, func(nc *NeatConfig) { nc.OrganismConfig = c })
+	require.Equal(t, []float64{0}, org.process([]float64{2}), "")
+}
@@ -0,0 +1,109 @@
+package neat
+
+import (
+	"math"
+)
+
+// Evaluate how well an organism generalizes with k-fold cross-validation.
+// The dataset of input and target pairs is split into k consecutive folds
+// of nearly equal size. For every fold a copy of the organism is trained
+// on the other folds with the Hebbian rule, see HebbianLearningRate, and
+// the loss of its predictions on the held-out fold is averaged. Returns the
+// mean loss over the folds, lower is better. k is limited to the size of
+// the dataset and fewer than two folds evaluates the whole dataset without
+// training, e.g. to measure the loss of the organism as it is. The
+// organism itself is left as it is.
+func CrossValidationEval(org *organism, dataset [][2][]float64, k int, lossFunc func(predicted, actual []float64) float64) float64 {
+	if len(dataset) == 0 {
+		return 0
+	}
+
+	folds := crossValidationFolds(len(dataset), k)
+	if len(folds) < 2 {
+		return meanLoss(org.clone(), dataset, lossFunc)
+	}
+
+	var total float64
+	for _, fold := range folds {
+		trained := org.clone()
+		trained.trainHebbian(dataset[:fold[0]])
+		trained.trainHebbian(dataset[fold[1]:])
+
+		total += meanLoss(trained, dataset[fold[0]:fold[1]], lossFunc)
+	}
+
+	return total / float64(len(folds))
+}
+
+// The learning rate of the Hebbian training unless HebbianLearningRate is
+// set, without training the held-out folds would only measure the loss of
+// the organism as it is
+const defaultHebbianLearningRate = 0.01
+
+// The start and end of k consecutive folds of a dataset of n samples, the
+// sizes of the folds differ by at most one
+func crossValidationFolds(n, k int) [][2]int {
+	k = max(1, min(k, n))
+
+	folds := make([][2]int, k)
+	for i := range folds {
+		folds[i] = [2]int{i * n / k, (i + 1) * n / k}
+	}
+
+	return folds
+}
+
+// The mean loss of the predictions of an organism on a set of samples,
+// the organism starts out at rest
+func meanLoss(org *organism, samples [][2][]float64, lossFunc func(predicted, actual []float64) float64) float64 {
+	org.resetStates()
+
+	var total float64
+	for _, sample := range samples {
+		total += lossFunc(org.process(sample[0]), sample[1])
+	}
+
+	return total / float64(len(samples))
+}
+
+// Train the weights on a set of samples with the Hebbian rule, a synapse
+// is strengthened by the learning rate times the product of the values
+// of the neurons it connects. The outputs take the value of the targets so
+// that the network learns the mapping rather than reinforcing its own
+// output. Weights stay within SynapseWeightBound and locked synapses are
+// left as they are.
+func (org *organism) trainHebbian(samples [][2][]float64) {
+	rate := config.OrganismConfig.HebbianLearningRate
+	if rate == 0 {
+		rate = defaultHebbianLearningRate
+	}
+
+	bound := config.OrganismConfig.SynapseWeightBound
+	org.resetStates()
+
+	for _, sample := range samples {
+		org.process(sample[0])
+
+		target := make(map[neuronID]float64, len(org.outputs))
+		for i, id := range org.outputs {
+			target[id] = sample[1][i]
+		}
+
+		for _, g := range org.genes {
+			s, ok := g.(*synapse)
+			if !ok || !s.enabled || s.locked {
+				continue
+			}
+
+			post, ok := target[s.out]
+			if !ok {
+				post = org.state(s.out).value
+			}
+
+			s.weight += rate * org.state(s.in).value * post
+			s.weight = math.Max(-bound, math.Min(bound, s.weight))
+		}
+	}
+
+	org.resetStates()
+}
@@ -0,0 +1,69 @@
+package neat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func squaredError(predicted, actual []float64) float64 {
+	var total float64
+	for i := range predicted {
+		total += (predicted[i] - actual[i]) * (predicted[i] - actual[i])
+	}
+	return total
+}
+
+func TestCrossValidationFolds(t *testing.T) {
+	require.Equal(t, [][2]int{{0, 3}, {3, 6}, {6, 10}}, crossValidationFolds(10, 3), "")
+	require.Equal(t, [][2]int{{0, 1}, {1, 2}}, crossValidationFolds(2, 5), "")
+	require.Equal(t, [][2]int{{0, 4}}, crossValidationFolds(4, 0), "")
+}
+
+func TestCrossValidationEval(t *testing.T) {
+	// y = x1 + x2
+	var dataset [][2][]float64
+	for i := 0; i < 10; i++ {
+		x1, x2 := float64(i), float64(i%3)
+		dataset = append(dataset, [2][]float64{{x1, x2}, {x1 + x2}})
+	}
+
+	// Every sample is held out exactly once
+	held := make(map[float64]int)
+	org := newOrganism(2, 1)
+	CrossValidationEval(org, dataset, 4, func(predicted, actual []float64) float64 {
+		held[actual[0]]++
+		return 0
+	})
+	require.Equal(t, len(dataset), len(held), "")
+	for _, n := range held {
+		require.Equal(t, 1, n, "")
+	}
+
+	// A network that learned the mapping has no loss without training, a
+	// network that only fits the samples where x1 equals x2 does
+	memorizer := newOrganism(2, 1)
+	memorizer.synapses[memorizer.connections[memorizer.sensors[0]][0]].weight = 2
+	memorizer.synapses[memorizer.connections[memorizer.sensors[1]][0]].weight = 0
+
+	general := CrossValidationEval(org, dataset, 1, squaredError)
+	memorized := CrossValidationEval(memorizer, dataset, 1, squaredError)
+	require.Equal(t, 0.0, general, "")
+	require.True(t, memorized > general, "")
+
+	// Training on the other folds changes the loss on the held-out fold, an
+	// untrained network learns to move towards the mapping
+	untrained := newOrganism(2, 1)
+	for _, s := range untrained.synapses {
+		s.weight = 0
+	}
+	before := untrained.clone()
+	loss := CrossValidationEval(untrained, dataset, 1, squaredError)
+	require.True(t, CrossValidationEval(untrained, dataset, 5, squaredError) < loss, "")
+
+	// Training happens on copies of the organism
+	require.True(t, GenomeDiff(before, untrained).Empty(), "")
+	for _, s := range untrained.synapses {
+		require.Equal(t, 0.0, s.weight, "")
+	}
+}
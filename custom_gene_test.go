@@ -0,0 +1,76 @@
+package neat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// A gene that scales the output values
+type gainGene struct {
+	innovation uint64
+	gain       float64
+}
+
+func (g *gainGene) getInnovation() uint64 {
+	return g.innovation
+}
+
+func (g *gainGene) Apply(org *organism) error {
+	if g.gain < 0 {
+		return errors.New("Negative gain")
+	}
+
+	for _, id := range org.outputs {
+		org.state(id).value *= g.gain
+	}
+
+	return nil
+}
+
+func TestCustomGene(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.Equal(t, []float64{2}, org.process([]float64{1, 1}), "")
+
+	gain := &gainGene{NextInnovation(), 3}
+	org.AddCustomGene(gain)
+	require.True(t, org.GenomeIsSorted(), "")
+	require.Equal(t, []float64{6}, org.process([]float64{1, 1}), "")
+
+	// Custom genes are inherited like other genes
+	require.Equal(t, []float64{6}, org.clone().process([]float64{1, 1}), "")
+
+	// Even from the less fit parent, it's an excess gene
+	other := org.clone()
+	other.genes = other.genes[:len(other.genes)-1]
+	other.fitness = org.fitness + 1
+	child := mate(other, org)
+	require.Equal(t, len(org.genes), len(child.genes), "")
+	require.Equal(t, []float64{6}, child.process([]float64{1, 1}), "")
+
+	// Every way of running the network applies the custom genes
+	require.Equal(t, []float64{6}, org.processFeedforward([]float64{1, 1}), "")
+	out, err := org.ProcessFeedforwardOnly([]float64{1, 1})
+	require.NoError(t, err, "")
+	require.Equal(t, []float64{6}, out, "")
+	out, finished := org.ProcessWithTimeout([]float64{1, 1}, time.Second)
+	require.True(t, finished, "")
+	require.Equal(t, []float64{6}, out, "")
+
+	// Another activation of the genome sees its own state
+	out, err = org.NewActivation().Process([]float64{1, 1})
+	require.NoError(t, err, "")
+	require.Equal(t, []float64{6}, out, "")
+
+	// Errors are returned by Process
+	org.AddCustomGene(&gainGene{NextInnovation(), -1})
+	_, err = org.Process([]float64{1, 1})
+	require.Error(t, err, "")
+	_, err = org.ProcessFeedforwardOnly([]float64{1, 1})
+	require.Error(t, err, "")
+	out, finished = org.ProcessWithTimeout([]float64{1, 1}, time.Second)
+	require.False(t, finished, "")
+	require.Nil(t, out, "")
+}
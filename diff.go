@@ -0,0 +1,158 @@
+package neat
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// The change of a synapse weight between two genomes
+type WeightChange struct {
+	Synapse synapseID
+	From    float64
+	To      float64
+}
+
+// The differences between two genomes, genes are matched by innovation
+// number. Added genes are identified by their id in the second genome and
+// removed genes by their id in the first.
+type Diff struct {
+	AddedNeurons   []neuronID
+	RemovedNeurons []neuronID
+
+	AddedSynapses   []synapseID
+	RemovedSynapses []synapseID
+
+	// Synapses that are enabled in one genome and disabled in the other
+	ToggledSynapses []synapseID
+
+	WeightChanges []WeightChange
+}
+
+// Is there no difference
+func (d Diff) Empty() bool {
+	return len(d.AddedNeurons) == 0 && len(d.RemovedNeurons) == 0 &&
+		len(d.AddedSynapses) == 0 && len(d.RemovedSynapses) == 0 &&
+		len(d.ToggledSynapses) == 0 && len(d.WeightChanges) == 0
+}
+
+// What changed from genome a to genome b, e.g. in a mutation
+func GenomeDiff(a, b *organism) Diff {
+	var d Diff
+
+	for _, pair := range alignGenes(a, b) {
+		switch {
+		case pair.a == nil:
+			switch g := pair.b.(type) {
+			case *neuron:
+				d.AddedNeurons = append(d.AddedNeurons, g.id)
+			case *synapse:
+				d.AddedSynapses = append(d.AddedSynapses, g.id)
+			}
+		case pair.b == nil:
+			switch g := pair.a.(type) {
+			case *neuron:
+				d.RemovedNeurons = append(d.RemovedNeurons, g.id)
+			case *synapse:
+				d.RemovedSynapses = append(d.RemovedSynapses, g.id)
+			}
+		default:
+			aSyn, aOk := pair.a.(*synapse)
+			bSyn, bOk := pair.b.(*synapse)
+			if !aOk || !bOk {
+				continue
+			}
+
+			if aSyn.enabled != bSyn.enabled {
+				d.ToggledSynapses = append(d.ToggledSynapses, bSyn.id)
+			}
+			if aSyn.weight != bSyn.weight {
+				d.WeightChanges = append(d.WeightChanges, WeightChange{bSyn.id, aSyn.weight, bSyn.weight})
+			}
+		}
+	}
+
+	return d
+}
+
+// The fraction of the innovation numbers in the reference that the
+// organism has a gene for, e.g. how much of a template genome a lineage
+// has kept. An empty reference is fully covered.
+func GenomeCoverage(org *organism, reference []uint64) float64 {
+	if len(reference) == 0 {
+		return 1
+	}
+
+	innovations := make(map[uint64]bool, len(org.genes))
+	for _, g := range org.genes {
+		innovations[g.getInnovation()] = true
+	}
+
+	covered := 0
+	for _, innovation := range reference {
+		if innovations[innovation] {
+			covered++
+		}
+	}
+
+	return float64(covered) / float64(len(reference))
+}
+
+// A side by side table of how the genes of two organisms line up in
+// crossover, one row per innovation number:
+//
+//	innovation | parent_a               | parent_b               | alignment
+//	1          | neuron 1 (sensor)      | neuron 1 (sensor)      | matching
+//	7          | synapse 1->2 w=0.5     |                        | disjoint-A
+//
+// A row is matching, disjoint-A, disjoint-B, excess-A or excess-B where
+// the suffix names the organism that has the gene.
+func AlignGenomes(a, b *organism) string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintln(w, "innovation\t| parent_a\t| parent_b\t| alignment")
+	for _, pair := range alignGenes(a, b) {
+		g, side := pair.a, "A"
+		if g == nil {
+			g, side = pair.b, "B"
+		}
+
+		label := "matching"
+		switch pair.alignment {
+		case disjointGene:
+			label = "disjoint-" + side
+		case excessGene:
+			label = "excess-" + side
+		}
+
+		fmt.Fprintf(w, "%d\t| %s\t| %s\t| %s\n",
+			g.getInnovation(), describeGene(pair.a), describeGene(pair.b), label)
+	}
+
+	w.Flush()
+	return buf.String()
+}
+
+// A short description of a gene, empty for no gene
+func describeGene(g gene) string {
+	switch g := g.(type) {
+	case *neuron:
+		kinds := map[neuronKind]string{
+			sensorNeuron: "sensor",
+			outputNeuron: "output",
+			hiddenNeuron: "hidden",
+		}
+		return fmt.Sprintf("neuron %d (%s)", g.id, kinds[g.kind])
+	case *synapse:
+		description := fmt.Sprintf("synapse %d->%d w=%g", g.in, g.out, g.weight)
+		if !g.enabled {
+			description += " (disabled)"
+		}
+		return description
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprintf("gene %d", g.getInnovation())
+}
@@ -0,0 +1,88 @@
+package neat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenomeDiff(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.True(t, GenomeDiff(org, org.clone()).Empty(), "")
+
+	// A split adds a neuron and two synapses and disables the split synapse
+	mutated := org.clone()
+	split := mutated.connections[mutated.sensors[0]][0]
+	mutated.splitSynapse(split)
+	hidden := mutated.genes[len(mutated.genes)-3].(*neuron)
+	in := mutated.genes[len(mutated.genes)-2].(*synapse)
+	out := mutated.genes[len(mutated.genes)-1].(*synapse)
+
+	d := GenomeDiff(org, mutated)
+	require.Equal(t, []neuronID{hidden.id}, d.AddedNeurons, "")
+	require.Equal(t, []synapseID{in.id, out.id}, d.AddedSynapses, "")
+	require.Equal(t, []synapseID{split}, d.ToggledSynapses, "")
+	require.Equal(t, 0, len(d.RemovedNeurons), "")
+	require.Equal(t, 0, len(d.RemovedSynapses), "")
+	require.Equal(t, 0, len(d.WeightChanges), "")
+
+	// The other way around the genes are removed
+	mutated.synapses[split].weight = 3
+	d = GenomeDiff(mutated, org)
+	require.Equal(t, []neuronID{hidden.id}, d.RemovedNeurons, "")
+	require.Equal(t, []synapseID{in.id, out.id}, d.RemovedSynapses, "")
+	require.Equal(t, []WeightChange{{split, 3, org.synapses[split].weight}}, d.WeightChanges, "")
+	require.Equal(t, 0, len(d.AddedNeurons), "")
+}
+
+func TestGenomeCoverage(t *testing.T) {
+	org := createGenome(1, 3, 5, 7, 9, 11)
+	clone := org.clone()
+
+	reference := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	require.Equal(t, 0.5, GenomeCoverage(clone, reference), "")
+	require.Equal(t, 0.0, GenomeCoverage(clone, []uint64{2, 4}), "")
+	require.Equal(t, 1.0, GenomeCoverage(clone, nil), "")
+}
+
+func TestAlignGenomes(t *testing.T) {
+	a := createGenome(1, 2, 4, 5)
+	b := createGenome(1, 3, 4, 6, 7)
+
+	lines := strings.Split(strings.TrimRight(AlignGenomes(a, b), "\n"), "\n")
+	require.Equal(t, 8, len(lines), "")
+
+	fields := func(line string) []string {
+		var fields []string
+		for _, f := range strings.Split(line, "|") {
+			fields = append(fields, strings.TrimSpace(f))
+		}
+		return fields
+	}
+	require.Equal(t, []string{"innovation", "parent_a", "parent_b", "alignment"}, fields(lines[0]), "")
+
+	expected := []struct {
+		innovation string
+		alignment  string
+	}{
+		{"1", "matching"},
+		{"2", "disjoint-A"},
+		{"3", "disjoint-B"},
+		{"4", "matching"},
+		{"5", "disjoint-A"},
+		{"6", "excess-B"},
+		{"7", "excess-B"},
+	}
+	for i, e := range expected {
+		row := fields(lines[i+1])
+		require.Equal(t, e.innovation, row[0], "")
+		require.Equal(t, e.alignment, row[3], "")
+
+		// Only the organisms that have the gene describe it
+		inA := e.alignment == "matching" || strings.HasSuffix(e.alignment, "A")
+		inB := e.alignment == "matching" || strings.HasSuffix(e.alignment, "B")
+		require.Equal(t, inA, strings.HasPrefix(row[1], "neuron"), "")
+		require.Equal(t, inB, strings.HasPrefix(row[2], "neuron"), "")
+	}
+}
@@ -0,0 +1,183 @@
+package neat
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Write the population as CSV, one row per organism with genome summary
+// statistics
+func (p *Population) ExportCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{
+		"organism_id",
+		"species_id",
+		"generation",
+		"fitness",
+		"age",
+		"num_neurons",
+		"num_enabled_synapses",
+		"num_disabled_synapses",
+		"depth",
+		"connection_density",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	for _, org := range p.organisms {
+		enabled := org.enabledSynapses()
+
+		row := []string{
+			strconv.FormatUint(org.id, 10),
+			strconv.FormatUint(org.species, 10),
+			strconv.Itoa(org.generation),
+			formatFloat(org.fitness),
+			strconv.Itoa(org.age),
+			strconv.Itoa(len(org.neurons)),
+			strconv.Itoa(enabled),
+			strconv.Itoa(len(org.synapses) - enabled),
+			strconv.Itoa(org.depth()),
+			formatFloat(org.ConnectionDensity()),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// The network in the Graphviz DOT language, sensors are boxes, outputs are
+// double circles and the enabled synapses are labeled with their weights.
+// Neurons and synapses are written in gene order.
+func (org *organism) ToDOT() string {
+	var b strings.Builder
+	b.WriteString("digraph organism {\n\trankdir=LR;\n")
+
+	shapes := map[neuronKind]string{
+		sensorNeuron: "box",
+		outputNeuron: "doublecircle",
+		hiddenNeuron: "circle",
+	}
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok {
+			fmt.Fprintf(&b, "\tn%d [shape=%s];\n", n.id, shapes[n.kind])
+		}
+	}
+
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && s.enabled {
+			fmt.Fprintf(&b, "\tn%d -> n%d [label=\"%s\"];\n",
+				s.in, s.out, strconv.FormatFloat(s.weight, 'g', 4, 64))
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// An operation of a compute graph. The operations read and write numbered
+// slots, see ToComputeGraph.
+type ComputeOp struct {
+	// "mul" multiplies the input by Value, "add" sums the inputs and Value
+	// and "activate" applies the activation function to the input
+	Kind string
+
+	InputIdx  []int
+	OutputIdx int
+
+	// The weight of a mul, the constant term of an add and the SumClamp
+	// limit of an activate, the input is clamped to [-Value, Value] before
+	// it is activated unless Value is zero
+	Value float64
+
+	// The name of the activation function of an activate, empty if the
+	// function wasn't configured by name
+	Activation string
+}
+
+// The organism as a flat sequence of operations for running it without
+// this package, e.g. on an edge device. The operations are in an order
+// where the slots they read have already been written. Slots 0 to
+// nInputs-1 hold the inputs and the last nOutputs operations write the
+// outputs in order. Recurrent networks and networks with custom genes
+// can't be flattened and return an error.
+func (org *organism) ToComputeGraph() ([]ComputeOp, error) {
+	order, recurrent := org.topologicalOrder()
+	if len(recurrent) > 0 {
+		return nil, errors.New("Recurrent networks have no compute graph")
+	}
+	for _, g := range org.genes {
+		if _, ok := g.(CustomGene); ok {
+			return nil, errors.New("Custom genes have no compute graph")
+		}
+	}
+
+	var ops []ComputeOp
+	slots := len(org.sensors)
+	newSlot := func() int {
+		slots++
+		return slots - 1
+	}
+
+	sensorSlot := make(map[neuronID]int, len(org.sensors))
+	for i, id := range org.sensors {
+		sensorSlot[id] = i
+	}
+
+	valueSlot := make(map[neuronID]int, len(order))
+	for _, id := range order {
+		n := org.neurons[id]
+
+		// The input sum of a sensor is the input itself
+		sum, isSensor := sensorSlot[id]
+		if !isSensor {
+			add := ComputeOp{Kind: "add"}
+			for _, sid := range org.incoming[id] {
+				s := org.synapses[sid]
+				if !s.enabled {
+					continue
+				}
+
+				mul := ComputeOp{Kind: "mul", InputIdx: []int{valueSlot[s.in]}, OutputIdx: newSlot(), Value: s.weight}
+				ops = append(ops, mul)
+				add.InputIdx = append(add.InputIdx, mul.OutputIdx)
+			}
+
+			add.OutputIdx = newSlot()
+			ops = append(ops, add)
+			sum = add.OutputIdx
+		}
+
+		// A silenced neuron is the constant zero
+		if n.regulated {
+			ops = append(ops, ComputeOp{Kind: "add", OutputIdx: newSlot()})
+		} else {
+			ops = append(ops, ComputeOp{
+				Kind:       "activate",
+				InputIdx:   []int{sum},
+				OutputIdx:  newSlot(),
+				Value:      config.OrganismConfig.SumClamp,
+				Activation: config.OrganismConfig.activationName(n.kind),
+			})
+		}
+		valueSlot[id] = ops[len(ops)-1].OutputIdx
+	}
+
+	for _, id := range org.outputs {
+		ops = append(ops, ComputeOp{Kind: "add", InputIdx: []int{valueSlot[id]}, OutputIdx: newSlot()})
+	}
+
+	return ops, nil
+}
@@ -0,0 +1,141 @@
+package neat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCSV(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+	})
+
+	population := NewPopulation(2, 1, PopulationOptions{})
+	population.Step(func(org *organism) float64 {
+		return org.process([]float64{1, 1})[0]
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, population.ExportCSV(&buf), "")
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err, "")
+
+	// A header and one row per organism
+	require.Equal(t, 11, len(records), "")
+	require.Equal(t, 10, len(records[0]), "")
+	require.Equal(t, "organism_id", records[0][0], "")
+
+	for _, record := range records[1:] {
+		for _, field := range record {
+			_, err := strconv.ParseFloat(field, 64)
+			require.NoError(t, err, "")
+		}
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	org := newOrganism(1, 1)
+	sensor, output := org.sensors[0], org.outputs[0]
+	org.synapses[org.connections[sensor][0]].weight = 0.5
+	require.Equal(t, 3, org.Complexity(), "")
+
+	expected := fmt.Sprintf("digraph organism {\n\trankdir=LR;\n"+
+		"\tn%d [shape=box];\n\tn%d [shape=doublecircle];\n"+
+		"\tn%d -> n%d [label=\"0.5\"];\n}\n", sensor, output, sensor, output)
+	require.Equal(t, expected, org.ToDOT(), "")
+
+	// Disabled synapses are left out
+	org.toggleEnabled(org.connections[sensor][0])
+	require.Equal(t, 2, org.Complexity(), "")
+	require.False(t, strings.Contains(org.ToDOT(), "->"), "")
+}
+
+// Run a compute graph the way a device without this package would
+func runComputeGraph(ops []ComputeOp, input []float64, nOutputs int) []float64 {
+	var slots []float64
+	write := func(i int, v float64) {
+		for len(slots) <= i {
+			slots = append(slots, 0)
+		}
+		slots[i] = v
+	}
+	for i, v := range input {
+		write(i, v)
+	}
+
+	for _, op := range ops {
+		switch op.Kind {
+		case "mul":
+			write(op.OutputIdx, slots[op.InputIdx[0]]*op.Value)
+		case "add":
+			sum := op.Value
+			for _, i := range op.InputIdx {
+				sum += slots[i]
+			}
+			write(op.OutputIdx, sum)
+		case "activate":
+			sum := slots[op.InputIdx[0]]
+			if op.Value > 0 {
+				sum = math.Max(-op.Value, math.Min(op.Value, sum))
+			}
+			write(op.OutputIdx, actFuncNameMap[op.Activation](sum))
+		}
+	}
+
+	out := make([]float64, nOutputs)
+	for i, op := range ops[len(ops)-nOutputs:] {
+		out[i] = slots[op.OutputIdx]
+	}
+	return out
+}
+
+func TestToComputeGraph(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.ActFunc = "Sigmoid"
+		c.OrganismConfig.actFunc = Sigmoid
+	})
+
+	// Two sensors, a hidden neuron between the first sensor and the output
+	org := newOrganism(2, 1)
+	org.splitSynapse(org.connections[org.sensors[0]][0])
+	for i, g := range org.genes {
+		if s, ok := g.(*synapse); ok {
+			s.weight = 0.5 - float64(i)*0.3
+		}
+	}
+
+	ops, err := org.ToComputeGraph()
+	require.NoError(t, err, "")
+
+	// Every op reads slots that have been written
+	written := map[int]bool{0: true, 1: true}
+	for _, op := range ops {
+		for _, i := range op.InputIdx {
+			require.True(t, written[i], "")
+		}
+		written[op.OutputIdx] = true
+	}
+
+	for _, input := range [][]float64{{0, 0}, {1, 0}, {0.5, -2}, {3, 1}} {
+		expected := org.process(input)
+		require.InDelta(t, expected[0], runComputeGraph(ops, input, 1)[0], 1e-12, "")
+	}
+
+	// The clamp is part of the activation
+	config.OrganismConfig.SumClamp = 0.2
+	ops, err = org.ToComputeGraph()
+	require.NoError(t, err, "")
+	require.InDelta(t, org.process([]float64{3, 1})[0], runComputeGraph(ops, []float64{3, 1}, 1)[0], 1e-12, "")
+
+	_, err = createSimpleRecurrent().ToComputeGraph()
+	require.Error(t, err, "")
+}
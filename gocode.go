@@ -0,0 +1,169 @@
+package neat
+
+import (
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The Go source of the activation functions by name, the body of a
+// function of x returning float64
+var actFuncSources = map[string]string{
+	"Sigmoid":     "expX := math.Exp(x)\nreturn expX / (expX + 1)",
+	"FastSigmoid": "return x / (1 + math.Abs(x))",
+	"Recifier":    "return math.Max(0, x)",
+	"Abs":         "return math.Abs(x)",
+	"Clamped":     "return math.Max(-1, math.Min(1, x))",
+	"ELU":         "if x >= 0 {\nreturn x\n}\nreturn math.Expm1(x)",
+	"Swish":       "if x >= 0 {\nreturn x / (1 + math.Exp(-x))\n}\nexpX := math.Exp(x)\nreturn x * expX / (1 + expX)",
+}
+
+// Generate a standalone Go source file in package pkg with a function
+// funcName computing the outputs of the network like process, with the
+// weights inlined and without depending on this package.
+//
+// A feedforward network becomes func(input []float64) []float64. A
+// recurrent network becomes func(input, state []float64) []float64 where
+// state carries the recurrent signals from one input to the next, it must
+// hold funcNameStateSize zeros before the first input.
+//
+// The activation functions must be configured by name and networks with
+// custom genes can't be generated.
+func (org *organism) GenerateGoCode(pkg, funcName string) (string, error) {
+	for _, g := range org.genes {
+		if _, ok := g.(CustomGene); ok {
+			return "", errors.New("Custom genes can't be generated")
+		}
+	}
+
+	_, recurrent := org.topologicalOrder()
+	order := org.EvaluationOrder()
+
+	position := make(map[neuronID]int, len(order))
+	for i, id := range order {
+		position[id] = i
+	}
+
+	sensor := make(map[neuronID]int, len(org.sensors))
+	for i, id := range org.sensors {
+		sensor[id] = i
+	}
+
+	// The terms of the input sum of every neuron and of the recurrent
+	// signals it receives at the next input, in the order the signals
+	// arrive
+	sums := make([][]string, len(order))
+	futures := make([][]string, len(order))
+	used := make([]bool, len(order))
+	for i, id := range order {
+		for _, sid := range org.connections[id] {
+			s := org.synapses[sid]
+			target, reached := position[s.out]
+			if !s.enabled || !reached {
+				continue
+			}
+
+			used[i] = true
+			term := fmt.Sprintf("v%d * %s", i, strconv.FormatFloat(s.weight, 'g', -1, 64))
+			if target <= i {
+				futures[target] = append(futures[target], term)
+			} else {
+				sums[target] = append(sums[target], term)
+			}
+		}
+	}
+
+	var body strings.Builder
+	actFuncs := make(map[string]bool)
+	for i, id := range order {
+		n := org.neurons[id]
+
+		var terms []string
+		if len(recurrent) > 0 {
+			terms = append(terms, fmt.Sprintf("state[%d]", i))
+		}
+		if j, ok := sensor[id]; ok {
+			terms = append(terms, fmt.Sprintf("input[%d]", j))
+		}
+		terms = append(terms, sums[i]...)
+		if len(terms) == 0 {
+			terms = []string{"0.0"}
+		}
+		fmt.Fprintf(&body, "s%d := %s\n", i, strings.Join(terms, " + "))
+
+		if n.regulated {
+			fmt.Fprintf(&body, "_ = s%d\nv%d := 0.0\n", i, i)
+			continue
+		}
+
+		if limit := config.OrganismConfig.SumClamp; limit > 0 {
+			l := strconv.FormatFloat(limit, 'g', -1, 64)
+			fmt.Fprintf(&body, "s%d = math.Max(-%s, math.Min(%s, s%d))\n", i, l, l, i)
+		}
+
+		name := config.OrganismConfig.activationName(n.kind)
+		if _, ok := actFuncSources[name]; !ok {
+			return "", fmt.Errorf("The activation function %q can't be generated", name)
+		}
+		actFuncs[name] = true
+		fmt.Fprintf(&body, "v%d := %s%s(s%d)\n", i, funcName, name, i)
+	}
+
+	outputs := make([]string, len(org.outputs))
+	for i, id := range org.outputs {
+		if j, ok := position[id]; ok {
+			outputs[i] = fmt.Sprintf("v%d", j)
+			used[j] = true
+		} else {
+			outputs[i] = "0"
+		}
+	}
+
+	// Neurons that don't send any signal
+	for i := range order {
+		if !used[i] {
+			fmt.Fprintf(&body, "_ = v%d\n", i)
+		}
+	}
+
+	// Every value is read before the recurrent signals are stored
+	for i, terms := range futures {
+		if len(terms) > 0 {
+			fmt.Fprintf(&body, "state[%d] = %s\n", i, strings.Join(terms, " + "))
+		}
+	}
+
+	fmt.Fprintf(&body, "return []float64{%s}\n", strings.Join(outputs, ", "))
+
+	var src strings.Builder
+	fmt.Fprintf(&src, "// Code generated from an evolved network. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if len(actFuncs) > 0 || config.OrganismConfig.SumClamp > 0 {
+		src.WriteString("import \"math\"\n\n")
+	}
+
+	if len(recurrent) > 0 {
+		fmt.Fprintf(&src, "// The size of the state of %s\nconst %sStateSize = %d\n\n", funcName, funcName, len(order))
+		fmt.Fprintf(&src, "func %s(input, state []float64) []float64 {\n%s}\n", funcName, body.String())
+	} else {
+		fmt.Fprintf(&src, "func %s(input []float64) []float64 {\n%s}\n", funcName, body.String())
+	}
+
+	names := make([]string, 0, len(actFuncs))
+	for name := range actFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&src, "\nfunc %s%s(x float64) float64 {\n%s\n}\n", funcName, name, actFuncSources[name])
+	}
+
+	formatted, err := format.Source([]byte(src.String()))
+	if err != nil {
+		return "", err
+	}
+
+	return string(formatted), nil
+}
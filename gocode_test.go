@@ -0,0 +1,116 @@
+package neat
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Build the generated code with a main function feeding it the inputs one
+// after the other and return the printed outputs, one line per input.
+// Skips the test if there is no Go toolchain.
+func runGeneratedCode(t *testing.T, src string, recurrent bool, inputs [][]float64) []string {
+	if _, err := exec.LookPath("go"); err != nil || testing.Short() {
+		t.Skip("No Go toolchain to build the generated code with")
+	}
+
+	var main strings.Builder
+	main.WriteString("package main\n\nimport \"fmt\"\n\nfunc main() {\n")
+	if recurrent {
+		main.WriteString("\tstate := make([]float64, netStateSize)\n")
+	}
+	for _, input := range inputs {
+		args := fmt.Sprintf("%#v", input)
+		if recurrent {
+			args += ", state"
+		}
+		fmt.Fprintf(&main, "\tfmt.Println(net(%s))\n", args)
+	}
+	main.WriteString("}\n")
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module generated\n\ngo 1.21\n",
+		"net.go":  src,
+		"main.go": main.String(),
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644), "")
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
+
+func TestGenerateGoCode(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.ActFunc, c.OrganismConfig.actFunc = "Sigmoid", Sigmoid
+		c.OrganismConfig.OutputActFunc = "Swish"
+		c.OrganismConfig.resolveActFuncs()
+		c.OrganismConfig.SumClamp = 1.5
+	})
+
+	inputs := [][]float64{{1, 0, 0}, {0.5, -1, 2}, {0, 0, 0}, {3, 2, 1}}
+
+	var feedforward *organism
+	for {
+		feedforward = createRandomOrganism(3, 2, 5, 5)
+		if _, recurrent := feedforward.topologicalOrder(); len(recurrent) == 0 {
+			break
+		}
+	}
+
+	recurrent := createSimpleRecurrent()
+	for _, s := range recurrent.synapses {
+		s.weight = 0.7
+	}
+	recurrentInputs := [][]float64{{1}, {0}, {0.5}, {-2}}
+
+	cases := []struct {
+		org    *organism
+		inputs [][]float64
+	}{
+		{feedforward, inputs},
+		{recurrent, recurrentInputs},
+	}
+
+	for _, c := range cases {
+		src, err := c.org.GenerateGoCode("main", "net")
+		require.NoError(t, err, "")
+
+		_, err = parser.ParseFile(token.NewFileSet(), "net.go", src, 0)
+		require.NoError(t, err, "")
+		require.False(t, strings.Contains(src, "neat"), "")
+
+		_, isRecurrent := c.org.topologicalOrder()
+		printed := runGeneratedCode(t, src, len(isRecurrent) > 0, c.inputs)
+
+		c.org.resetStates()
+		for i, input := range c.inputs {
+			require.Equal(t, fmt.Sprint(c.org.process(input)), printed[i], "")
+		}
+	}
+}
+
+func TestGenerateGoCodeErrors(t *testing.T) {
+	// The test configuration's activation function has no name
+	_, err := newOrganism(1, 1).GenerateGoCode("main", "net")
+	require.Error(t, err, "")
+
+	org := newOrganism(1, 1)
+	org.AddCustomGene(&gainGene{NextInnovation(), 2})
+	_, err = org.GenerateGoCode("main", "net")
+	require.Error(t, err, "")
+}
@@ -0,0 +1,89 @@
+package neat
+
+import (
+	"errors"
+	"math"
+)
+
+// The coordinates of a substrate node
+type Point struct {
+	X float64
+	Y float64
+}
+
+// A HyperNEAT substrate, the geometric layout of a network whose synapse
+// weights are generated by a CPPN. The substrate is layered, every input
+// node connects to every hidden node and every hidden node to every output
+// node. Without hidden nodes the inputs connect directly to the outputs.
+type Substrate struct {
+	Inputs  []Point
+	Hidden  []Point
+	Outputs []Point
+
+	// Synapses whose generated weight has an absolute value below the
+	// threshold are left out of the network
+	WeightThreshold float64
+}
+
+// Build the substrate network from a CPPN. The CPPN is queried with the
+// coordinates of both endpoints, x1, y1, x2, y2, of every potential
+// synapse and its single output is used as the synapse weight. Returns an
+// error if the CPPN doesn't have four inputs and one output or can't
+// process the coordinates.
+func (s *Substrate) Build(cppn *organism) (*organism, error) {
+	if len(cppn.sensors) != 4 || len(cppn.outputs) != 1 {
+		return nil, errors.New("A CPPN must have four inputs and one output")
+	}
+
+	org := _newOrganism(len(s.Inputs), len(s.Outputs))
+
+	addLayer := func(kind neuronKind, points []Point) []*neuron {
+		layer := make([]*neuron, len(points))
+		for i := range points {
+			layer[i] = _newNeuron(kind)
+			org.addNeuron(layer[i])
+		}
+		return layer
+	}
+
+	inputs := addLayer(sensorNeuron, s.Inputs)
+	hidden := addLayer(hiddenNeuron, s.Hidden)
+	outputs := addLayer(outputNeuron, s.Outputs)
+
+	connect := func(in []*neuron, inPoints []Point, out []*neuron, outPoints []Point) error {
+		for i, a := range inPoints {
+			for j, b := range outPoints {
+				output, err := cppn.Process([]float64{a.X, a.Y, b.X, b.Y})
+				if err != nil {
+					return err
+				}
+
+				weight := output[0]
+				if math.Abs(weight) < s.WeightThreshold {
+					continue
+				}
+
+				synapse := newSynapse(in[i], out[j])
+				synapse.weight = weight
+				org.addSynapse(synapse)
+			}
+		}
+
+		return nil
+	}
+
+	if len(hidden) == 0 {
+		if err := connect(inputs, s.Inputs, outputs, s.Outputs); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := connect(inputs, s.Inputs, hidden, s.Hidden); err != nil {
+			return nil, err
+		}
+		if err := connect(hidden, s.Hidden, outputs, s.Outputs); err != nil {
+			return nil, err
+		}
+	}
+
+	return org, nil
+}
@@ -0,0 +1,54 @@
+package neat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubstrateBuild(t *testing.T) {
+	// A CPPN computing x1 + 2 * y2
+	cppn := newOrganism(4, 1)
+	weights := make(map[synapseID]float64)
+	for i, id := range cppn.sensors {
+		weights[cppn.connections[id][0]] = []float64{1, 0, 0, 2}[i]
+	}
+	require.NoError(t, cppn.SetWeights(weights), "")
+
+	substrate := &Substrate{
+		Inputs:          []Point{{-1, -1}, {0, -1}, {1, -1}},
+		Outputs:         []Point{{-1, 1}, {1, 1}},
+		WeightThreshold: 0.5,
+	}
+	org, err := substrate.Build(cppn)
+	require.NoError(t, err, "")
+
+	require.Equal(t, 3, len(org.sensors), "")
+	require.Equal(t, 2, len(org.outputs), "")
+
+	// The synapse from the middle input has weight 0 + 2 and those from
+	// the outer inputs weigh -1 + 2 and 1 + 2
+	expected := []float64{1, 2, 3}
+	for i, id := range org.sensors {
+		require.Equal(t, 2, len(org.connections[id]), "")
+		for _, sid := range org.connections[id] {
+			require.Equal(t, expected[i], org.synapses[sid].weight, "")
+		}
+	}
+
+	// With a hidden layer at the origin the weights into the hidden node
+	// are x1 and the ones out of it are 2 * y2, the synapse from the middle
+	// input falls below the threshold
+	substrate.Hidden = []Point{{0, 0}}
+	org, err = substrate.Build(cppn)
+	require.NoError(t, err, "")
+
+	require.Equal(t, 4, len(org.synapses), "")
+	require.Equal(t, 0, len(org.connections[org.sensors[1]]), "")
+	require.Equal(t, []float64{2, 2}, org.process([]float64{0, 0, 1}), "")
+	require.Equal(t, []float64{0, 0}, org.process([]float64{1, 0, 1}), "")
+
+	// A CPPN must take the coordinates of both endpoints
+	_, err = substrate.Build(newOrganism(2, 1))
+	require.Error(t, err, "")
+}
@@ -0,0 +1,16 @@
+//go:build ignore
+
+// This file documents that neuron and synapse ids can't be mixed up, it
+// must NOT compile. Without the build constraint above the package fails
+// to build with "cannot use n (variable of uint64 type neuronID) as
+// synapseID value".
+package neat
+
+func mixIDs() {
+	var n neuronID = 1
+	var s synapseID = n
+	_ = s
+
+	org := newOrganism(1, 1)
+	org.getSynapse(org.sensors[0])
+}
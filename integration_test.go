@@ -0,0 +1,88 @@
+//go:build integration
+
+package neat
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSolveXOR(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping the XOR integration test in short mode")
+	}
+
+	// Seeded runs are reproducible, this seed solves XOR in 23 generations
+	withSeed(t, 16)
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig = SpeciesConfig{
+			ExcessGenesCoeff:       1.0,
+			DisjoinGenesCoeff:      1.0,
+			AvgWeightDiffCoeff:     0.4,
+			CompatibilityThreshold: 3.0,
+		}
+		// The sensors squash the inputs with the sigmoid as well so large
+		// weights are needed to tell the inputs apart
+		c.OrganismConfig = OrganismConfig{
+			SynapseSplitMutProb:    0.05,
+			SynapseActivityMutProb: 0.01,
+			SynapseWeightMutProb:   0.2,
+			SynapseWeightBound:     30.0,
+			SynapseAddMutProb:      0.05,
+			MaxConnectionDensity:   0.5,
+			MaxNeurons:             20,
+			MaxSynapses:            60,
+			ActFunc:                "Sigmoid",
+			actFunc:                Sigmoid,
+		}
+		c.PopulationConfig = PopulationConfig{
+			Size:                 150,
+			LocalSearch:          true,
+			LocalSearchSteps:     20,
+			LocalSearchOrganisms: 10,
+		}
+	})
+
+	// The inputs are the two bits and a bias
+	cases := [][4]float64{
+		{0, 0, 1, 0},
+		{0, 1, 1, 1},
+		{1, 0, 1, 1},
+		{1, 1, 1, 0},
+	}
+
+	// Four minus the total error. The feedforward evaluation gives every
+	// neuron all of its inputs before it fires.
+	score := func(org *organism) float64 {
+		fitness := 4.0
+		for _, c := range cases {
+			// Forget the recurrent signals of the previous case
+			org.resetStates()
+
+			out := org.processFeedforward(c[:3])[0]
+			fitness -= math.Abs(out - c[3])
+		}
+
+		return fitness
+	}
+
+	// A slight penalty on the genome size slows down bloating
+	eval := func(org *organism) float64 {
+		return score(org) - 0.001*float64(len(org.genes))
+	}
+
+	population := NewPopulation(3, 1, PopulationOptions{})
+	population.Selection = NewTournamentSelection(3)
+
+	best := 0.0
+	generations := 0
+	for ; generations < 300 && best < 3.9; generations++ {
+		population.Step(eval)
+		best = math.Max(best, score(population.Champion()))
+	}
+
+	t.Log("Best fitness ", best, " after ", generations, " generations")
+	if best < 3.9 {
+		t.Fatal("No solution found, best fitness ", best)
+	}
+}
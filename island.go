@@ -0,0 +1,130 @@
+package neat
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// A population evolving on its own in an island model, see RunIslands
+type Island struct {
+	Pop *Population
+	ID  int
+}
+
+// Create n islands with populations of the configured size. The organisms
+// of all islands descend from the same genome so that migrants share their
+// innovation numbers with the organisms of the island they move to.
+func NewIslands(n, nInputs, nOutputs int, options PopulationOptions) []*Island {
+	islands := make([]*Island, n)
+	for i := range islands {
+		var p *Population
+		if i == 0 {
+			p = NewPopulation(nInputs, nOutputs, options)
+		} else {
+			organisms := make([]*organism, len(islands[0].Pop.organisms))
+			for j, org := range islands[0].Pop.organisms {
+				organisms[j] = org.clone()
+				for _, g := range organisms[j].genes {
+					if s, ok := g.(*synapse); ok {
+						s.mutateWeight(config.OrganismConfig.SynapseWeightBound)
+					}
+				}
+			}
+
+			p = newPopulationFrom(nInputs, nOutputs, organisms)
+			p.options = options
+		}
+
+		islands[i] = &Island{Pop: p, ID: i}
+	}
+
+	return islands
+}
+
+// Evolve the islands side by side until stop, called after every
+// generation with the number of generations evolved and the best fitness
+// of all islands, returns true. Every migrationInterval generations the
+// migrantsPerIsland fittest organisms of every island move to the next
+// island in a ring, replacing its least fit organisms. The islands step
+// concurrently so the fitness function must be safe for concurrent use,
+// unless RandFloat64 is replaced, e.g. by a seeded generator that isn't
+// safe for concurrent use, in which case they step one after the other.
+// A zero interval disables migration.
+func RunIslands(islands []*Island, migrationInterval int, migrantsPerIsland int, eval func(*organism) float64, stop func(int, float64) bool) {
+	for generation := 1; len(islands) > 0; generation++ {
+		if randIsShared() {
+			var wg sync.WaitGroup
+			for _, island := range islands {
+				wg.Add(1)
+				go func(p *Population) {
+					defer wg.Done()
+					p.Step(eval)
+				}(island.Pop)
+			}
+			wg.Wait()
+		} else {
+			for _, island := range islands {
+				island.Pop.Step(eval)
+			}
+		}
+
+		best := math.Inf(-1)
+		for _, island := range islands {
+			if champion := island.Pop.Champion(); champion != nil {
+				best = math.Max(best, champion.fitness)
+			}
+		}
+
+		if stop(generation, best) {
+			return
+		}
+
+		if migrationInterval > 0 && generation%migrationInterval == 0 {
+			migrate(islands, migrantsPerIsland)
+		}
+	}
+}
+
+// Move copies of the n fittest organisms of every island to the next
+// island in the ring, where they replace the n least fit organisms. The
+// migrants keep their fitness.
+func migrate(islands []*Island, n int) {
+	if len(islands) < 2 || n <= 0 {
+		return
+	}
+
+	// Pick every island's emigrants before any island receives migrants
+	emigrants := make([][]*organism, len(islands))
+	for i, island := range islands {
+		emigrants[i] = fittest(island.Pop.organisms, n)
+	}
+
+	for i, island := range islands {
+		p := island.Pop
+		migrants := reconcileGenes(p.organisms, emigrants[(i+len(islands)-1)%len(islands)])
+
+		sort.SliceStable(p.organisms, func(i, j int) bool {
+			return fitter(p.organisms[i], p.organisms[j])
+		})
+		for j, migrant := range migrants[:min(len(migrants), len(p.organisms))] {
+			clone := migrant.clone()
+			clone.generation = migrant.generation
+			clone.fitness = migrant.fitness
+			p.organisms[len(p.organisms)-1-j] = clone
+		}
+
+		p.registry.reset(p.organisms)
+	}
+}
+
+// The n fittest organisms, fittest first
+func fittest(organisms []*organism, n int) []*organism {
+	sorted := make([]*organism, len(organisms))
+	copy(sorted, organisms)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return fitter(sorted[i], sorted[j])
+	})
+
+	return sorted[:min(n, len(sorted))]
+}
@@ -0,0 +1,113 @@
+package neat
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIslands(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+	})
+
+	islands := NewIslands(3, 2, 1, PopulationOptions{})
+	require.Equal(t, 3, len(islands), "")
+	for i, island := range islands {
+		require.Equal(t, i, island.ID, "")
+		require.Equal(t, 10, island.Pop.Size(), "")
+	}
+
+	// The islands share their innovation numbers
+	a, b := islands[0].Pop.organisms[0], islands[2].Pop.organisms[0]
+	require.Equal(t, 0, len(GenomeDiff(a, b).AddedSynapses), "")
+	require.Equal(t, 0, len(GenomeDiff(a, b).AddedNeurons), "")
+}
+
+func TestMigrate(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+	})
+
+	islands := NewIslands(2, 2, 1, PopulationOptions{})
+	migrant := islands[0].Pop.organisms[4]
+	migrant.splitSynapse(migrant.connections[migrant.sensors[0]][0])
+	migrant.fitness = 100
+	innovation := migrant.genes[len(migrant.genes)-1].getInnovation()
+	require.False(t, hasInnovation(islands[1].Pop.organisms[0], innovation), "")
+
+	migrate(islands, 1)
+
+	received := 0
+	for _, org := range islands[1].Pop.organisms {
+		if hasInnovation(org, innovation) {
+			received++
+			require.Equal(t, 100.0, org.fitness, "")
+		}
+	}
+	require.Equal(t, 1, received, "")
+	require.Equal(t, 10, islands[1].Pop.Size(), "")
+}
+
+func TestRunIslands(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+	})
+
+	islands := NewIslands(3, 2, 1, PopulationOptions{})
+	special := islands[0].Pop.organisms[0]
+	special.splitSynapse(special.connections[special.sensors[0]][0])
+	innovation := special.genes[len(special.genes)-1].getInnovation()
+
+	// Only the descendants of the special organism have any fitness, they
+	// reach the other islands by migration
+	eval := func(org *organism) float64 {
+		if hasInnovation(org, innovation) {
+			return 1
+		}
+		return 0
+	}
+
+	var generations []int
+	RunIslands(islands, 1, 2, eval, func(generation int, best float64) bool {
+		generations = append(generations, generation)
+		require.Equal(t, 1.0, best, "")
+		return generation == 3
+	})
+
+	require.Equal(t, []int{1, 2, 3}, generations, "")
+	for _, island := range islands {
+		require.Equal(t, 3, island.Pop.Generation(), "")
+		require.True(t, hasInnovation(island.Pop.Champion(), innovation), "")
+	}
+}
+
+func TestRunIslandsSeeded(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+		c.OrganismConfig.MaxNeurons = 10
+		c.OrganismConfig.MaxSynapses = 20
+	})
+
+	// A seeded generator isn't safe for concurrent use, the islands step
+	// one after the other and the run is reproducible
+	run := func() []float64 {
+		withSeed(t, 1)
+
+		islands := NewIslands(3, 2, 1, PopulationOptions{})
+		eval := func(org *organism) float64 {
+			return -math.Abs(org.processFeedforward([]float64{1, 1})[0] - 0.5)
+		}
+
+		var best []float64
+		RunIslands(islands, 2, 1, eval, func(generation int, fitness float64) bool {
+			best = append(best, fitness)
+			return generation == 5
+		})
+
+		return best
+	}
+
+	require.Equal(t, run(), run(), "")
+}
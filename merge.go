@@ -0,0 +1,185 @@
+package neat
+
+import (
+	"errors"
+	"sort"
+)
+
+// Merge two populations into one, e.g. populations that evolved separately
+// or a population loaded from a checkpoint next to a live one. The genes of
+// b are renumbered if they clash with the genes of a, the organisms are
+// speciated anew and only the fittest organisms are kept if there are more
+// than the larger of the two populations. The merged population continues
+// from the later generation of the two.
+func MergePopulations(a, b *Population) (*Population, error) {
+	if a.nInputs != b.nInputs || a.nOutputs != b.nOutputs {
+		return nil, errors.New("Populations have different numbers of inputs or outputs")
+	}
+
+	organisms := make([]*organism, 0, len(a.organisms)+len(b.organisms))
+	organisms = append(organisms, a.organisms...)
+	organisms = append(organisms, reconcileGenes(a.organisms, b.organisms)...)
+
+	size := max(len(a.organisms), len(b.organisms))
+	if len(organisms) > size {
+		sort.SliceStable(organisms, func(i, j int) bool {
+			return fitter(organisms[i], organisms[j])
+		})
+		organisms = organisms[:size]
+	}
+
+	p := newPopulationFrom(a.nInputs, a.nOutputs, organisms)
+	p.generation = max(a.generation, b.generation)
+	p.options = a.options
+	p.Selection = a.Selection
+	p.species = speciate(nil, organisms)
+
+	return p, nil
+}
+
+// Make the genes of the organisms of b compatible with the genes of the
+// organisms of a. If the two share their innovation numbers and ids, i.e.
+// they were created by the same process, the organisms of b are returned
+// as they are. Otherwise the sensors and outputs of b are mapped onto the
+// sensors and outputs of a and every other gene gets a new innovation
+// number and id, in the original innovation order.
+func reconcileGenes(a, b []*organism) []*organism {
+	if len(a) == 0 || len(b) == 0 || !genesClash(a, b) {
+		return b
+	}
+
+	innovations := make(map[uint64]uint64)
+	neurons := make(map[neuronID]neuronID)
+	synapses := make(map[synapseID]synapseID)
+
+	// The sensors and outputs of b become those of a
+	template := a[0]
+	mapNeurons := func(from, to []neuronID, org *organism) {
+		for i, id := range from {
+			neurons[id] = to[i]
+			innovations[org.neurons[id].innovation] = template.neurons[to[i]].innovation
+		}
+	}
+	for _, org := range b {
+		mapNeurons(org.sensors, template.sensors, org)
+		mapNeurons(org.outputs, template.outputs, org)
+	}
+
+	// Every other gene of b in innovation order, a gene shared by several
+	// organisms is only renumbered once
+	var genes []gene
+	seen := make(map[uint64]bool)
+	for _, org := range b {
+		for _, g := range org.genes {
+			if n, ok := g.(*neuron); ok && n.kind != hiddenNeuron {
+				continue
+			}
+			if !seen[g.getInnovation()] {
+				seen[g.getInnovation()] = true
+				genes = append(genes, g)
+			}
+		}
+	}
+	sort.SliceStable(genes, func(i, j int) bool {
+		return genes[i].getInnovation() < genes[j].getInnovation()
+	})
+
+	for _, g := range genes {
+		innovations[g.getInnovation()] = nextInnovation()
+		switch g := g.(type) {
+		case *neuron:
+			neurons[g.id] = neuronID(nextID())
+		case *synapse:
+			synapses[g.id] = synapseID(nextID())
+		}
+	}
+
+	reconciled := make([]*organism, len(b))
+	for i, org := range b {
+		clone := _newOrganism(len(org.sensors), len(org.outputs))
+		clone.generation = org.generation
+		clone.fitness = org.fitness
+		clone.age = org.age
+
+		for _, g := range org.genes {
+			switch g := g.(type) {
+			case *neuron:
+				n := g.clone()
+				n.id = neurons[g.id]
+				n.innovation = innovations[g.innovation]
+				clone.addNeuron(n)
+			case *synapse:
+				s := g.clone()
+				s.id = synapses[g.id]
+				s.in = neurons[g.in]
+				s.out = neurons[g.out]
+				s.innovation = innovations[g.innovation]
+				clone.addSynapse(s)
+			case CustomGene:
+				// Custom genes keep their innovation number
+				clone.AddCustomGene(g)
+			}
+		}
+
+		clone.SortGenes()
+		reconciled[i] = clone
+	}
+
+	return reconciled
+}
+
+// Do the organisms of b use an innovation number or id of the organisms
+// of a for a different gene, or have different sensors or outputs
+func genesClash(a, b []*organism) bool {
+	type identity struct {
+		innovation uint64
+		id         uint64
+		synapse    bool
+	}
+
+	byInnovation := make(map[uint64]identity)
+	key := func(g gene) identity {
+		switch g := g.(type) {
+		case *neuron:
+			return identity{g.innovation, uint64(g.id), false}
+		case *synapse:
+			return identity{g.innovation, uint64(g.id), true}
+		}
+		return identity{}
+	}
+
+	ids := make(map[uint64]uint64)
+	for _, org := range a {
+		for _, g := range org.genes {
+			k := key(g)
+			byInnovation[k.innovation] = k
+			ids[k.id] = k.innovation
+		}
+	}
+
+	template := a[0]
+	for _, org := range b {
+		for i, id := range org.sensors {
+			if id != template.sensors[i] {
+				return true
+			}
+		}
+		for i, id := range org.outputs {
+			if id != template.outputs[i] {
+				return true
+			}
+		}
+
+		for _, g := range org.genes {
+			k := key(g)
+			if other, ok := byInnovation[k.innovation]; ok && other != k {
+				return true
+			}
+			if innovation, ok := ids[k.id]; ok && innovation != k.innovation {
+				return true
+			}
+		}
+	}
+
+	return false
+}
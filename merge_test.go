@@ -0,0 +1,105 @@
+package neat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Fail if an innovation number or id stands for different genes in
+// different organisms
+func requireConsistentGenes(t *testing.T, organisms []*organism) {
+	type identity struct {
+		id      uint64
+		in, out neuronID
+	}
+
+	byInnovation := make(map[uint64]identity)
+	byID := make(map[uint64]uint64)
+	for _, org := range organisms {
+		require.True(t, org.GenomeIsSorted(), "")
+
+		for _, g := range org.genes {
+			var k identity
+			switch g := g.(type) {
+			case *neuron:
+				k = identity{id: uint64(g.id)}
+			case *synapse:
+				k = identity{uint64(g.id), g.in, g.out}
+			}
+
+			if other, ok := byInnovation[g.getInnovation()]; ok {
+				require.Equal(t, other, k, "")
+			}
+			byInnovation[g.getInnovation()] = k
+
+			if innovation, ok := byID[k.id]; ok {
+				require.Equal(t, innovation, g.getInnovation(), "")
+			}
+			byID[k.id] = g.getInnovation()
+		}
+	}
+}
+
+func TestMergePopulations(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0.1
+		c.OrganismConfig.SynapseAddMutProb = 0.3
+		c.OrganismConfig.SynapseWeightMutProb = 0.5
+		c.PopulationConfig.Size = 10
+	})
+
+	eval := func(org *organism) float64 {
+		var sum float64
+		for _, s := range org.synapses {
+			sum += s.weight
+		}
+		return sum
+	}
+
+	// Two populations evolved by "different processes", the counters are
+	// rewound so that they reuse innovation numbers and ids for different
+	// genes
+	innovation, id := innovationCount.Load(), idCount.Load()
+	a := NewPopulation(2, 1, PopulationOptions{})
+	for i := 0; i < 5; i++ {
+		a.Step(eval)
+	}
+
+	aInnovation, aID := innovationCount.Load(), idCount.Load()
+	innovationCount.Store(innovation + 100)
+	idCount.Store(id + 100)
+	b := NewPopulation(2, 1, PopulationOptions{})
+	for i := 0; i < 6; i++ {
+		b.Step(eval)
+	}
+	advanceCounters(aInnovation, aID)
+	require.True(t, genesClash(a.organisms, b.organisms), "")
+
+	merged, err := MergePopulations(a, b)
+	require.NoError(t, err, "")
+	require.Equal(t, 10, merged.Size(), "")
+	require.Equal(t, 6, merged.Generation(), "")
+	require.True(t, len(merged.Species()) > 0, "")
+	requireConsistentGenes(t, merged.organisms)
+
+	for i := 0; i < 5; i++ {
+		merged.Step(eval)
+		requireConsistentGenes(t, merged.organisms)
+	}
+
+	// Organisms that descend from the same organisms merge as they are
+	require.False(t, genesClash(a.organisms, a.organisms[:3]), "")
+	require.Equal(t, a.organisms[:3], reconcileGenes(a.organisms, a.organisms[:3]), "")
+
+	// Populations with their own sensors and outputs are mapped onto the
+	// sensors and outputs of the first
+	c := NewPopulation(2, 1, PopulationOptions{})
+	merged, err = MergePopulations(merged, c)
+	require.NoError(t, err, "")
+	requireConsistentGenes(t, merged.organisms)
+
+	_, err = MergePopulations(a, NewPopulation(3, 1, PopulationOptions{}))
+	require.Error(t, err, "")
+}
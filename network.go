@@ -1,16 +1,25 @@
 package neat
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 // The global organism configuration
 var config NeatConfig
 
-// Set the global organism configuration
+// Set the global organism configuration, activation functions that
+// aren't set are looked up by name
 func SetNeatConfig(neatConfig NeatConfig) {
+	neatConfig.OrganismConfig.resolveActFuncs()
 	config = neatConfig
 }
 
@@ -20,18 +29,24 @@ type ActivationFunction func(float64) float64
 // Expose the random function so that it can be manipulated by tests
 var RandFloat64 = rand.Float64
 
-// Global innovation counter
-var innovationCount uint64
+// Global innovation counter. The atomic types guarantee 64-bit alignment,
+// which a plain uint64 does not on 32-bit architectures.
+var innovationCount atomic.Uint64
 
 // Global identifier counter
-var idCount uint64
+var idCount atomic.Uint64
 
 func nextInnovation() uint64 {
-	return atomic.AddUint64(&innovationCount, 1)
+	return innovationCount.Add(1)
+}
+
+// A new innovation number, e.g. for a custom gene
+func NextInnovation() uint64 {
+	return nextInnovation()
 }
 
 func nextID() uint64 {
-	return atomic.AddUint64(&idCount, 1)
+	return idCount.Add(1)
 }
 
 // The most general things that can be said about the genes
@@ -39,6 +54,24 @@ type gene interface {
 	getInnovation() uint64
 }
 
+var (
+	_ gene = (*neuron)(nil)
+	_ gene = (*synapse)(nil)
+
+	_ fmt.Stringer = (*organism)(nil)
+)
+
+// Genetic material beyond neurons and synapses, e.g. a gene modulating the
+// signals. Custom genes are aligned by innovation number when mating like
+// any other gene and applied in gene order after the signals have been
+// propagated through the network, however the network is run. They are
+// shared rather than copied between organisms so they should not change
+// once created. Organisms with custom genes can't be saved.
+type CustomGene interface {
+	gene
+	Apply(*organism) error
+}
+
 type synapseID uint64
 type neuronID uint64
 type neuronKind int
@@ -56,6 +89,8 @@ type synapse struct {
 	enabled bool
 	// Innovation number
 	innovation uint64
+	// Locked synapses are never mutated
+	locked bool
 }
 
 // Create a new synapse from the in neuron to the out neuron
@@ -84,9 +119,10 @@ func (s *synapse) toggleEnabled() {
 	s.enabled = !s.enabled
 }
 
-// Perturbe the weight of a synapse
-func (s *synapse) mutateWeight() {
-	s.weight = 2 * ((RandFloat64() - 0.5) * config.OrganismConfig.SynapseWeightBound)
+// Perturbe the weight of a synapse, the new weight is drawn from
+// [-bound, bound]
+func (s *synapse) mutateWeight(bound float64) {
+	s.weight = 2 * ((RandFloat64() - 0.5) * bound)
 }
 
 // The different kinds of neurons
@@ -106,14 +142,21 @@ type neuron struct {
 	id neuronID
 
 	// Gene things
-	// Current output value
-	value float64
 	// Innovation number
 	innovation uint64
 	// Neuron kind
 	kind neuronKind
+	// Locked neurons are never removed
+	locked bool
+	// Regulated neurons are silenced, their output is always zero
+	regulated bool
+}
 
-	// Topology things
+// The transient state of a neuron while the organism processes inputs. It
+// is kept apart from the neuron so that the genome only holds genetic data.
+type neuronState struct {
+	// Current output value
+	value float64
 	// Future output accumulator, if the network is recurrent
 	future float64
 	// Input sum
@@ -153,8 +196,24 @@ func (n *neuron) getInnovation() uint64 {
 	return n.innovation
 }
 
+// The output of the neuron for an input sum
+func (n *neuron) activate(sum float64) float64 {
+	if n.regulated {
+		return 0
+	}
+
+	if limit := config.OrganismConfig.SumClamp; limit > 0 {
+		sum = math.Max(-limit, math.Min(limit, sum))
+	}
+
+	return config.OrganismConfig.activation(n.kind)(sum)
+}
+
 // An organism that holds a set of neurons and synapses.
 type organism struct {
+	// Unique id of the organism
+	id uint64
+
 	// A set of sensor neurons
 	sensors []neuronID
 	// A set of output neurons
@@ -165,6 +224,8 @@ type organism struct {
 	synapses map[synapseID]*synapse
 	// Map from neuron id to outgoing synapse ids
 	connections map[neuronID][]synapseID
+	// Map from neuron id to incoming synapse ids
+	incoming map[neuronID][]synapseID
 
 	// Genes in order of appearance
 	genes []gene
@@ -174,10 +235,129 @@ type organism struct {
 
 	// Evolutionary fitness value
 	fitness float64
+
+	// The standard deviation of the fitness over the trials of the last
+	// stochastic evaluation
+	fitnessStdDev float64
+
+	// The number of generations the organism has survived
+	age int
+
+	// The id of the species the organism belongs to
+	species uint64
+
+	// The cached evaluation order of the neurons and the recurrent
+	// synapses, recomputed when topoDirty is set by a structural change
+	topoOrder     []neuronID
+	topoRecurrent map[synapseID]bool
+	topoDirty     bool
+
+	// The synapse graph of a feedforward network in compressed sparse row
+	// form, kept between inputs. Cleared when the topological order is
+	// recomputed.
+	csr *csrGraph
+
+	// The activation of the inputs given to the organism itself, nil while
+	// the organism is at rest
+	active *Activation
+}
+
+// A short description of the organism
+func (org *organism) String() string {
+	return fmt.Sprintf("organism %d (generation %d, fitness %g, %d neurons, %d synapses)",
+		org.id, org.generation, org.fitness, len(org.neurons), len(org.synapses))
+}
+
+// The transient state of the neurons of an organism while it processes a
+// series of inputs, e.g. during an evaluation. The genome only holds
+// genetic data so that an organism at rest takes no room for its state,
+// and several activations can process inputs on the same genome at once
+// as long as the genome doesn't change meanwhile.
+type Activation struct {
+	org *organism
+
+	// The state of each neuron at the index given by index
+	states []neuronState
+	index  map[neuronID]int
+}
+
+// Start processing inputs with every neuron of the organism at rest
+func (org *organism) NewActivation() *Activation {
+	// The evaluation order is worked out up front, after that processing
+	// inputs only reads the genome
+	if _, recurrent := org.topologicalOrder(); len(recurrent) == 0 && org.csr == nil {
+		g := org.buildCSR()
+		org.csr = &g
+	}
+
+	return &Activation{org: org}
+}
+
+// Feed a new slice of inputs to the network and return the output, like
+// Process on the organism but with the state of this activation
+func (a *Activation) Process(input []float64) ([]float64, error) {
+	if len(input) != len(a.org.sensors) {
+		return nil, errors.New("Number of inputs doesn't match number of sensors")
+	}
+
+	a.feed(input)
+	if err := a.propagate(); err != nil {
+		return nil, err
+	}
+
+	out := make([]float64, len(a.org.outputs))
+	for i, id := range a.org.outputs {
+		out[i] = a.state(id).value
+	}
+
+	return out, nil
+}
+
+// Make sure every neuron has a state, neurons added since the last input
+// start out at rest
+func (a *Activation) allocate() {
+	if len(a.states) == len(a.org.neurons) {
+		return
+	}
+
+	if a.index == nil {
+		a.index = make(map[neuronID]int, len(a.org.neurons))
+	}
+
+	for _, g := range a.org.genes {
+		if n, ok := g.(*neuron); ok {
+			if _, ok := a.index[n.id]; !ok {
+				a.index[n.id] = len(a.states)
+				a.states = append(a.states, neuronState{})
+			}
+		}
+	}
+}
+
+// The state of a neuron, only valid once the states are allocated
+func (a *Activation) state(id neuronID) *neuronState {
+	return &a.states[a.index[id]]
+}
+
+// The activation of the organism's own inputs, started at the first input
+// after the organism was at rest
+func (org *organism) activation() *Activation {
+	if org.active == nil {
+		org.active = org.NewActivation()
+	}
+
+	return org.active
 }
 
-type species struct {
-	population []organism
+// The state of a neuron in the organism's own activation
+func (org *organism) state(id neuronID) *neuronState {
+	return org.activation().state(id)
+}
+
+// Bring every neuron back to rest, forgetting the recurrent signals and
+// releasing the state
+func (org *organism) resetStates() {
+	org.active = nil
 }
 
 // Creates an empty organism
@@ -190,15 +370,18 @@ func _newOrganism(nInputs, nOutputs int) *organism {
 	neurons := make(map[neuronID]*neuron)
 	synapses := make(map[synapseID]*synapse)
 	connections := make(map[neuronID][]synapseID)
+	incoming := make(map[neuronID][]synapseID)
 	genes := make([]gene, nInputs * nOutputs)
 	genes = genes[:0]
 
 	return &organism{
+		id: nextID(),
 		sensors:  sensors,
 		outputs:  outputs,
 		neurons:  neurons,
 		synapses: synapses,
 		connections: connections,
+		incoming: incoming,
 		genes: genes,
 	}
 }
@@ -227,6 +410,30 @@ func newOrganism(nInputs, nOutputs int) *organism {
 	return org
 }
 
+// Create an organism where every sensor is connected to every output
+// through a synapse with a random weight
+func newFullyConnectedOrganism(nInputs, nOutputs int) *organism {
+	org := _newOrganism(nInputs, nOutputs)
+
+	for i := 0; i < nInputs; i++ {
+		org.addNeuron(newSensorNeuron())
+	}
+
+	for i := 0; i < nOutputs; i++ {
+		org.addNeuron(newOutputNeuron())
+	}
+
+	for _, in := range org.sensors {
+		for _, out := range org.outputs {
+			synapse := newSynapse(org.neurons[in], org.neurons[out])
+			synapse.mutateWeight(config.OrganismConfig.SynapseWeightBound)
+			org.addSynapse(synapse)
+		}
+	}
+
+	return org
+}
+
 func (org *organism) clone() *organism {
 	clone := _newOrganism(len(org.sensors), len(org.outputs))
 
@@ -236,16 +443,78 @@ func (org *organism) clone() *organism {
 			clone.addNeuron(g.clone())
 		case *synapse:
 			clone.addSynapse(g.clone())
+		case CustomGene:
+			clone.AddCustomGene(g)
+		}
+	}
+
+	return clone
+}
+
+// A clone that keeps each synapse with the given probability, an output
+// that would be left without synapses keeps one of its synapses at random.
+// Used with a fully connected organism to create sparse initial topologies
+// that share innovation numbers.
+func (org *organism) sparseClone(prob float64) *organism {
+	// The synapses into each output
+	incoming := make(map[neuronID][]*synapse)
+	keep := make(map[synapseID]bool)
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok {
+			incoming[s.out] = append(incoming[s.out], s)
+			keep[s.id] = RandFloat64() < prob
+		}
+	}
+
+	for _, id := range org.outputs {
+		synapses := incoming[id]
+		connected := false
+		for _, s := range synapses {
+			connected = connected || keep[s.id]
+		}
+
+		if !connected && len(synapses) > 0 {
+			keep[synapses[randIntn(len(synapses))].id] = true
+		}
+	}
+
+	clone := _newOrganism(len(org.sensors), len(org.outputs))
+	for _, gene := range org.genes {
+		switch g := gene.(type) {
+		case *neuron:
+			clone.addNeuron(g.clone())
+		case *synapse:
+			if keep[g.id] {
+				clone.addSynapse(g.clone())
+			}
+		case CustomGene:
+			clone.AddCustomGene(g)
 		}
 	}
 
 	return clone
 }
 
+// Sort the genes by innovation number, the order alignGenes and mate
+// expect, e.g. after loading genes from an external source
+func (org *organism) SortGenes() {
+	sort.SliceStable(org.genes, func(i, j int) bool {
+		return org.genes[i].getInnovation() < org.genes[j].getInnovation()
+	})
+}
+
+// Are the genes in increasing innovation order
+func (org *organism) GenomeIsSorted() bool {
+	return sort.SliceIsSorted(org.genes, func(i, j int) bool {
+		return org.genes[i].getInnovation() < org.genes[j].getInnovation()
+	})
+}
+
 // Add a neuron
 func (org *organism) addNeuron(neuron *neuron) {
 	org.neurons[neuron.id] = neuron
 	org.genes = append(org.genes, neuron)
+	org.topoDirty = true
 
 	switch neuron.kind {
 	case sensorNeuron:
@@ -259,7 +528,110 @@ func (org *organism) addNeuron(neuron *neuron) {
 func (org *organism) addSynapse(synapse *synapse) {
 	org.synapses[synapse.id] = synapse
 	org.connections[synapse.in] = append(org.connections[synapse.in], synapse.id)
+	org.incoming[synapse.out] = append(org.incoming[synapse.out], synapse.id)
 	org.genes = append(org.genes, synapse)
+	org.topoDirty = true
+}
+
+// The ids of the synapses into a neuron, enabled or not, in the order they
+// were added
+func (org *organism) incomingSynapses(id neuronID) []synapseID {
+	return org.incoming[id]
+}
+
+// The ids of the synapses into a neuron, enabled or not, in the order they
+// were added. The slice is a copy and can be modified freely.
+func (org *organism) IncomingSynapses(id neuronID) []synapseID {
+	return append([]synapseID(nil), org.incoming[id]...)
+}
+
+// Add a custom gene. Like neurons and synapses it is expected to have a
+// higher innovation number than the genes already added, see NextInnovation.
+func (org *organism) AddCustomGene(g CustomGene) {
+	org.genes = append(org.genes, g)
+}
+
+// Apply the custom genes in gene order
+func (a *Activation) applyCustomGenes() error {
+	// The genes see the state of this activation, an activation of its own
+	// is shown on a copy of the organism
+	org := a.org
+	for _, g := range org.genes {
+		c, ok := g.(CustomGene)
+		if !ok {
+			continue
+		}
+
+		if org.active != a {
+			view := *a.org
+			view.active = a
+			org = &view
+		}
+		if err := c.Apply(org); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove a neuron and every synapse into or out of it
+func (org *organism) removeNeuron(id neuronID) {
+	removed := make(map[synapseID]bool)
+	for sid, s := range org.synapses {
+		if s.in == id || s.out == id {
+			removed[sid] = true
+		}
+	}
+
+	genes := org.genes[:0]
+	for _, g := range org.genes {
+		switch g := g.(type) {
+		case *neuron:
+			if g.id == id {
+				continue
+			}
+		case *synapse:
+			if removed[g.id] {
+				org.connections[g.in] = removeSynapseID(org.connections[g.in], g.id)
+				org.incoming[g.out] = removeSynapseID(org.incoming[g.out], g.id)
+				delete(org.synapses, g.id)
+				continue
+			}
+		}
+		genes = append(genes, g)
+	}
+	org.genes = genes
+
+	delete(org.neurons, id)
+	delete(org.connections, id)
+	delete(org.incoming, id)
+	org.sensors = removeNeuronID(org.sensors, id)
+	org.outputs = removeNeuronID(org.outputs, id)
+	org.topoDirty = true
+
+	// The states are indexed by neuron
+	org.resetStates()
+}
+
+func removeSynapseID(ids []synapseID, id synapseID) []synapseID {
+	for i, other := range ids {
+		if other == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+
+	return ids
+}
+
+func removeNeuronID(ids []neuronID, id neuronID) []neuronID {
+	for i, other := range ids {
+		if other == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+
+	return ids
 }
 
 // Lookup a neuron
@@ -272,6 +644,42 @@ func (org *organism) getSynapse(id synapseID) *synapse {
 	return org.synapses[id]
 }
 
+// Lookup a synapse by innovation number, nil if there is none
+func (org *organism) synapseByInnovation(innovation uint64) *synapse {
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && s.innovation == innovation {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// The weight of the synapse with an innovation number. Unlike ids,
+// innovation numbers are shared by clones and offspring. Returns false if
+// the organism has no such synapse.
+func (org *organism) WeightByInnovation(innovation uint64) (float64, bool) {
+	s := org.synapseByInnovation(innovation)
+	if s == nil {
+		return 0, false
+	}
+
+	return s.weight, true
+}
+
+// Set the weight of the synapse with an innovation number, e.g. to probe
+// how a connection affects the output. Returns false if the organism has no
+// such synapse.
+func (org *organism) SetWeightByInnovation(innovation uint64, weight float64) bool {
+	s := org.synapseByInnovation(innovation)
+	if s == nil {
+		return false
+	}
+
+	s.weight = weight
+	return true
+}
+
 // Lookup synapse endpoint neurons
 func (org *organism) synapseEndpoints(id synapseID) (*neuron, *neuron) {
 	synapse := org.getSynapse(id)
@@ -280,28 +688,137 @@ func (org *organism) synapseEndpoints(id synapseID) (*neuron, *neuron) {
 
 // Mutate the organism
 func (org *organism) mutate() {
-	for _, synapseIDs := range org.connections {
-		for _, id := range synapseIDs {
-			// Instead of just doing everything there we delegate, this
-			// makes testing a lot easier
+	org.mutateWith(config.OrganismConfig)
+}
 
-			if RandFloat64() <= config.OrganismConfig.SynapseSplitMutProb {
-				org.splitSynapse(id)
-			}
-			if RandFloat64() <= config.OrganismConfig.SynapseActivityMutProb {
-				org.toggleEnabled(id)	
-			}
+// Mutate the organism with the mutation probabilities of the given
+// configuration, e.g. the decayed ones of a population
+func (org *organism) mutateWith(c OrganismConfig) {
+	// Synapses in gene order so that a seeded run is reproducible, the
+	// synapses added by splits are left for the next mutation
+	var synapses []*synapse
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok {
+			synapses = append(synapses, s)
+		}
+	}
 
-			if RandFloat64() <= config.OrganismConfig.SynapseWeightMutProp {
-				org.mutateWeight(id)
-			}
+	for _, s := range synapses {
+		id := s.id
+
+		// Locked synapses are left as they are
+		if s.locked {
+			continue
+		}
+
+		// Instead of just doing everything there we delegate, this
+		// makes testing a lot easier
+
+		if RandFloat64() <= c.SynapseSplitMutProb {
+			org.splitSynapseWith(id, c)
+		}
+		if RandFloat64() <= c.SynapseActivityMutProb {
+			org.toggleEnabled(id)
 		}
+
+		if c.CorrelatedWeightMutation == 0 && RandFloat64() <= c.SynapseWeightMutProb {
+			org.mutateWeight(id, c.SynapseWeightBound)
+		}
+	}
+
+	if c.CorrelatedWeightMutation > 0 {
+		org.mutateIncomingWeights(c)
+	}
+
+	if RandFloat64() <= c.SynapseAddMutProb {
+		org.addConnectionWith(c)
+	}
+
+	if p := c.RegulationMutProb; p > 0 && RandFloat64() <= p {
+		org.toggleRegulation()
+	}
+}
+
+// Silence the neurons that are signalled true and express the ones that
+// are signalled false, like a gene regulatory network switching genes on
+// and off. Neurons without a signal are left as they are.
+func (org *organism) ApplyRegulation(signals map[neuronID]bool) {
+	for id, regulated := range signals {
+		if n, ok := org.neurons[id]; ok {
+			n.regulated = regulated
+		}
+	}
+}
+
+// Toggle the regulation of a random hidden neuron, locked neurons are left
+// as they are. Returns false if there is no such neuron.
+func (org *organism) toggleRegulation() bool {
+	var hidden []*neuron
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok && n.kind == hiddenNeuron && !n.locked {
+			hidden = append(hidden, n)
+		}
+	}
+
+	if len(hidden) == 0 {
+		return false
+	}
+
+	n := hidden[randIntn(len(hidden))]
+	n.regulated = !n.regulated
+
+	return true
+}
+
+// Apply a single random mutation under the given configuration that leaves
+// the neurons as they are: perturb the weight of a synapse, toggle a
+// synapse or add a connection. Locked synapses are left as they are.
+func (org *organism) mutateOnce(c OrganismConfig) {
+	var unlocked []synapseID
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && !s.locked {
+			unlocked = append(unlocked, s.id)
+		}
+	}
+
+	kind := randIntn(3)
+	if kind == 2 && org.addConnectionWith(c) {
+		return
+	}
+	if len(unlocked) == 0 {
+		return
+	}
+
+	id := unlocked[randIntn(len(unlocked))]
+	if kind == 1 {
+		org.toggleEnabled(id)
+	} else {
+		org.mutateWeight(id, c.SynapseWeightBound)
+	}
+}
+
+// Is there room in the genome for a number of new neurons and synapses
+// under MaxNeurons and MaxSynapses
+func (org *organism) canGrow(c OrganismConfig, neurons, synapses int) bool {
+	if c.MaxNeurons > 0 && len(org.neurons)+neurons > c.MaxNeurons {
+		return false
 	}
+
+	return c.MaxSynapses <= 0 || len(org.synapses)+synapses <= c.MaxSynapses
 }
 
 // Split a synapse, creates two new synapses with a neuron in between
-// to replace the old synapse and then disables the old synapse.
+// to replace the old synapse and then disables the old synapse. Nothing
+// happens if the genome would exceed MaxNeurons or MaxSynapses.
 func (org *organism) splitSynapse(id synapseID) {
+	org.splitSynapseWith(id, config.OrganismConfig)
+}
+
+// Split a synapse under the limits of the given configuration
+func (org *organism) splitSynapseWith(id synapseID, c OrganismConfig) {
+	if !org.canGrow(c, 1, 2) {
+		return
+	}
 
 	// The in and out neurons of this synapse
 	in, out := org.synapseEndpoints(id)
@@ -316,6 +833,7 @@ func (org *organism) splitSynapse(id synapseID) {
 
 	// The replaced synapse becomes inactive
 	org.synapses[id].enabled = false
+	org.topoDirty = true
 
 	// Now do the bookkeeping in the organism, it is important that
 	// the genes are added in order and that the neuron is added
@@ -325,101 +843,556 @@ func (org *organism) splitSynapse(id synapseID) {
 	org.addSynapse(synOut)
 }
 
-func (org *organism) toggleEnabled(id synapseID) {
-	org.synapses[id].toggleEnabled()
+// Lock the gene with the given innovation number, e.g. a gene copied from
+// a pretrained network. A locked synapse keeps its weight and enabled state
+// and is never split, a locked neuron is never removed.
+func (org *organism) LockGene(innovation uint64) {
+	org.setLocked(innovation, true)
 }
 
-func (org *organism) mutateWeight(id synapseID) {
-	org.synapses[id].mutateWeight()
+// Unlock the gene with the given innovation number
+func (org *organism) UnlockGene(innovation uint64) {
+	org.setLocked(innovation, false)
 }
 
-// The "genetic distance" between two organism
-type distance struct {
-	// The number of excess genes
-	excess int
-	// The number of disjoint genes
-	disjoint int
-	// The average weight difference of matching genes
-	weightDiff float64
-	// The number of genes in the larger genome
-	nbrGenes int
+// Is the gene locked
+func isLocked(g gene) bool {
+	switch g := g.(type) {
+	case *neuron:
+		return g.locked
+	case *synapse:
+		return g.locked
+	}
+
+	return false
 }
 
-// Mate two organism producing an offspring with the combined topology
-// of its parents.
-func mate(a, b *organism) *organism {
-	if len(a.sensors) != len(b.sensors) ||
-		len(a.outputs) != len(b.outputs) {
-		log.Fatal("Wooooh easy there fella' that's illegal")
+func (org *organism) setLocked(innovation uint64, locked bool) {
+	for _, gene := range org.genes {
+		if gene.getInnovation() != innovation {
+			continue
+		}
+
+		switch g := gene.(type) {
+		case *neuron:
+			g.locked = locked
+		case *synapse:
+			g.locked = locked
+		}
 	}
+}
 
-	// Create an empty offspring
-	offspring := _newOrganism(len(a.sensors), len(a.outputs))
-	offspring.generation = a.generation + 1
+func (org *organism) toggleEnabled(id synapseID) {
+	org.synapses[id].toggleEnabled()
+	org.topoDirty = true
+}
 
-	// Line up the genes and start building the new topology
-	aLen := len(a.genes) // Number of genes in a
-	bLen := len(b.genes) // and in b
-	
-	var aIdx int // the index into a.innovation
-	var bIdx int // the index into b.innovation
+func (org *organism) mutateWeight(id synapseID, bound float64) {
+	org.synapses[id].mutateWeight(bound)
+}
 
-	// Start copying the genes into the offspring
-	for aIdx, bIdx  = 0, 0; aIdx < aLen || bIdx < bLen; {
-		var aGene gene
-		var bGene gene
+// Mutate the incoming weights of each neuron together, with probability
+// SynapseWeightMutProb all of them are scaled by the same random factor
+// and clamped to SynapseWeightBound. Locked synapses are left as they are.
+func (org *organism) mutateIncomingWeights(c OrganismConfig) {
+	incoming := make(map[neuronID][]*synapse)
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && !s.locked {
+			incoming[s.out] = append(incoming[s.out], s)
+		}
+	}
 
-		// Get the next gene from the parents unless they're exhausted
-		if aIdx < aLen {
-			aGene = a.genes[aIdx]
+	for _, g := range org.genes {
+		n, ok := g.(*neuron)
+		if !ok || len(incoming[n.id]) == 0 ||
+			RandFloat64() > c.SynapseWeightMutProb {
+			continue
 		}
-		if bIdx < bLen {
-			bGene = b.genes[bIdx]
+
+		bound := c.SynapseWeightBound
+		scale := 1 + randNormFloat64()*c.CorrelatedWeightMutation
+		for _, s := range incoming[n.id] {
+			s.weight = math.Max(-bound, math.Min(bound, s.weight*scale))
 		}
+	}
+}
 
-		// This is what the child will inherit
-		var inheritance gene
+// Set the weights of the given synapses, e.g. after tuning them outside of
+// the evolution. Fails without changing any weight if a synapse is unknown.
+func (org *organism) SetWeights(weights map[synapseID]float64) error {
+	var unknown []string
+	for id := range weights {
+		if _, ok := org.synapses[id]; !ok {
+			unknown = append(unknown, strconv.FormatUint(uint64(id), 10))
+		}
+	}
 
-		// Both parent could provide genes
-		if aGene != nil && bGene != nil {
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.New("Unknown synapses: " + strings.Join(unknown, ", "))
+	}
 
-			aInov := aGene.getInnovation()
-			bInov := bGene.getInnovation()
+	for id, weight := range weights {
+		org.synapses[id].weight = weight
+	}
 
-			if aInov == bInov {
-				// If these are the same genes inherit from the fittest parent
-				if a.fitness > b.fitness {
-					inheritance = aGene
-				} else {
-					inheritance = bGene
-				}
+	return nil
+}
 
-				aIdx++
-				bIdx++
-			} else if aInov < bInov {
-				// Inherit from a if it has the lower innovation number
-				inheritance = aGene
-				aIdx++
-			} else if bInov < aInov {
-				// Inherit from b if it has the lower innovation number
-				inheritance = bGene
-				bIdx++
-			}
+// Add a synapse with a random weight between two randomly chosen neurons
+// that aren't already connected. Sensors only receive the input signals so
+// they are never the target of a synapse. Returns false if no synapse was
+// added, either because all neurons are connected or because the synapse
+// would exceed the maximum connection density or MaxSynapses.
+func (org *organism) addConnection() bool {
+	return org.addConnectionWith(config.OrganismConfig)
+}
 
-		} else if aGene != nil {
+// Add a connection like addConnection under the given configuration
+func (org *organism) addConnectionWith(c OrganismConfig) bool {
+	if !org.canGrow(c, 0, 1) {
+		return false
+	}
 
-			// The end of b's genes has been reached, inherit from a
-			inheritance = aGene
-			aIdx++
+	maxDensity := c.MaxConnectionDensity
+	nNeurons := float64(len(org.neurons))
+	if maxDensity > 0 &&
+		float64(org.enabledSynapses()+1) > maxDensity*nNeurons*(nNeurons-1) {
+		return false
+	}
+
+	// Neurons in gene order to keep the choice reproducible
+	neurons := make([]*neuron, 0, len(org.neurons))
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok {
+			neurons = append(neurons, n)
+		}
+	}
+
+	// Find all unconnected pairs of neurons
+	type pair struct{ in, out *neuron }
+	var candidates []pair
+	for _, in := range neurons {
+		connected := make(map[neuronID]bool)
+		for _, id := range org.connections[in.id] {
+			connected[org.synapses[id].out] = true
+		}
+
+		for _, out := range neurons {
+			if in != out && out.kind != sensorNeuron && !connected[out.id] {
+				candidates = append(candidates, pair{in, out})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return false
+	}
+
+	p := candidates[randIntn(len(candidates))]
+	synapse := newSynapse(p.in, p.out)
+	synapse.mutateWeight(c.SynapseWeightBound)
+	org.addSynapse(synapse)
+
+	return true
+}
+
+// The size of a local search weight perturbation relative to the weight
+// bound
+const localSearchStepSize = 0.1
+
+// Tune the weights of the organism by hill-climbing. Each pass perturbs
+// every enabled, unlocked synapse weight slightly in turn and keeps the
+// change if it improves the fitness. The organism's fitness is assumed to
+// be up to date and is updated with the tuned fitness.
+func (org *organism) tuneWeights(eval FitnessFunction, steps int) {
+	// Synapses in gene order to keep the tuning reproducible
+	var synapses []*synapse
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && s.enabled && !s.locked {
+			synapses = append(synapses, s)
+		}
+	}
+
+	for i := 0; i < steps; i++ {
+		for _, s := range synapses {
+			org.climbWeight(s, eval)
+		}
+	}
+}
+
+// Tune the weights of an organism by stochastic hill-climbing. Every step
+// perturbs the weight of a random enabled, unlocked synapse and keeps the
+// change only if it improves the fitness. Like tuneWeights the organism's
+// fitness is assumed to be up to date, it is set to, and returns, the
+// final fitness.
+func HillClimbWeights(org *organism, eval func(*organism) float64, maxSteps int) float64 {
+	var synapses []*synapse
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && s.enabled && !s.locked {
+			synapses = append(synapses, s)
+		}
+	}
+
+	if len(synapses) == 0 {
+		return org.fitness
+	}
 
-		} else if bGene != nil {
+	for i := 0; i < maxSteps; i++ {
+		org.climbWeight(synapses[randIntn(len(synapses))], eval)
+	}
+
+	return org.fitness
+}
+
+// Perturb the weight of a synapse slightly, clamped to SynapseWeightBound,
+// and keep the change if it improves the fitness of the organism, a single
+// hill-climbing step
+func (org *organism) climbWeight(s *synapse, eval func(*organism) float64) {
+	bound := config.OrganismConfig.SynapseWeightBound
+	step := localSearchStepSize * bound
+	weight := s.weight
+	s.weight += 2 * (RandFloat64() - 0.5) * step
+	s.weight = math.Max(-bound, math.Min(bound, s.weight))
+
+	if fitness := eval(org); fitness > org.fitness {
+		org.fitness = fitness
+	} else {
+		s.weight = weight
+	}
+}
+
+// The number of enabled synapses
+func (org *organism) enabledSynapses() int {
+	count := 0
+	for _, s := range org.synapses {
+		if s.enabled {
+			count++
+		}
+	}
+
+	return count
+}
+
+// The ratio of enabled synapses to the number of possible synapses,
+// N * (N - 1) for N neurons
+func (org *organism) ConnectionDensity() float64 {
+	n := float64(len(org.neurons))
+	if n < 2 {
+		return 0
+	}
+
+	return float64(org.enabledSynapses()) / (n * (n - 1))
+}
+
+// The size of the network, the number of neurons and enabled synapses
+func (org *organism) Complexity() int {
+	return len(org.neurons) + org.enabledSynapses()
+}
+
+// Scale the enabled synapse weights so that the largest absolute weight
+// equals SynapseWeightBound. Locked synapses are left as they are. Does
+// nothing if all weights are zero.
+func (org *organism) NormalizeWeights() {
+	var largest float64
+	for _, s := range org.synapses {
+		if s.enabled && !s.locked {
+			largest = math.Max(largest, math.Abs(s.weight))
+		}
+	}
+
+	if largest == 0 {
+		return
+	}
+
+	scale := config.OrganismConfig.SynapseWeightBound / largest
+	for _, s := range org.synapses {
+		if s.enabled && !s.locked {
+			s.weight *= scale
+		}
+	}
+}
+
+// Snap every synapse weight to the nearest of 2^bits evenly spaced values
+// spanning [-SynapseWeightBound, SynapseWeightBound] so that each weight
+// can be stored in bits bits, e.g. to run the network on a microcontroller.
+// Weights beyond the bound are snapped to the bound and fewer than one bit
+// is treated as one bit. Returns the largest change of a weight.
+func (org *organism) QuantizeWeights(bits int) float64 {
+	bound := config.OrganismConfig.SynapseWeightBound
+	step := 2 * bound / (math.Exp2(float64(max(bits, 1))) - 1)
+
+	var largest float64
+	for _, g := range org.genes {
+		s, ok := g.(*synapse)
+		if !ok {
+			continue
+		}
+
+		clamped := math.Max(-bound, math.Min(bound, s.weight))
+		quantized := -bound + math.Round((clamped+bound)/step)*step
+		largest = math.Max(largest, math.Abs(quantized-s.weight))
+		s.weight = quantized
+	}
+
+	return largest
+}
+
+// The distributions a weight table can be drawn from
+const (
+	// Evenly distributed in [-bound, bound]
+	WeightTableUniform = "uniform"
+
+	// Normally distributed around zero with a standard deviation of half
+	// the bound, clamped to [-bound, bound]
+	WeightTableNormal = "normal"
+)
+
+// Generate a table of nWeights weights from a distribution, the same seed
+// always generates the same table. A whole population can be initialized
+// from one table with ApplyWeightTable. Fails if the strategy is unknown.
+func InitializeWeightTable(nWeights int, seed int64, strategy string, bound float64) ([]float64, error) {
+	r := rand.New(rand.NewSource(seed))
+
+	var draw func() float64
+	switch strategy {
+	case WeightTableUniform:
+		draw = func() float64 {
+			return bound * (2*r.Float64() - 1)
+		}
+	case WeightTableNormal:
+		draw = func() float64 {
+			return math.Max(-bound, math.Min(bound, 0.5*bound*r.NormFloat64()))
+		}
+	default:
+		return nil, errors.New("Unknown weight table strategy: " + strategy)
+	}
+
+	table := make([]float64, max(nWeights, 0))
+	for i := range table {
+		table[i] = draw()
+	}
+
+	return table, nil
+}
+
+// Set the weights of the enabled synapses in gene order to the values of
+// the table, starting over from the beginning of the table if there are
+// more synapses than values. Locked synapses keep their weight but still
+// use up a value so that the other synapses get the same weights either
+// way. Does nothing if the table is empty.
+func (org *organism) ApplyWeightTable(table []float64) {
+	if len(table) == 0 {
+		return
+	}
 
-			// The end of a's genes has been reached, inherit from b
-			inheritance = bGene
+	i := 0
+	for _, g := range org.genes {
+		s, ok := g.(*synapse)
+		if !ok || !s.enabled {
+			continue
+		}
+
+		if !s.locked {
+			s.weight = table[i%len(table)]
+		}
+		i++
+	}
+}
+
+// Count the enabled synapse weights in nBuckets equal-width buckets spanning
+// [-SynapseWeightBound, SynapseWeightBound]. Returns the center of each
+// bucket and the number of weights in it. Weights beyond the bound are
+// counted in the outermost buckets. Without buckets both slices are empty.
+func (org *organism) WeightHistogram(nBuckets int) (buckets []float64, counts []int) {
+	if nBuckets <= 0 {
+		return []float64{}, []int{}
+	}
+
+	bound := config.OrganismConfig.SynapseWeightBound
+	width := 2 * bound / float64(nBuckets)
+
+	buckets = make([]float64, nBuckets)
+	for i := range buckets {
+		buckets[i] = -bound + (float64(i)+0.5)*width
+	}
+
+	counts = make([]int, nBuckets)
+	for _, s := range org.synapses {
+		if s.enabled {
+			i := int(math.Floor((s.weight + bound) / width))
+			counts[max(0, min(i, nBuckets-1))]++
+		}
+	}
+
+	return buckets, counts
+}
+
+// The "genetic distance" between two organism
+type distance struct {
+	// The number of excess genes
+	excess int
+	// The number of disjoint genes
+	disjoint int
+	// The average weight difference of matching genes
+	weightDiff float64
+	// The number of genes in the larger genome
+	nbrGenes int
+}
+
+// How a gene lines up against the genes of another genome
+type alignment int
+
+const (
+	// Both genomes have a gene with the innovation number
+	matchingGenes alignment = iota
+	// Only one of the genomes has the gene and the innovation number is
+	// within the innovation range of the other genome
+	disjointGene
+	// Only one of the genomes has the gene and the innovation number is
+	// beyond the innovation range of the other genome
+	excessGene
+)
+
+// A pair of aligned genes, either gene is nil if only one of the genomes
+// has a gene with the innovation number
+type genePair struct {
+	a gene
+	b gene
+	alignment alignment
+}
+
+// Line up the genes of two organisms by innovation number. The genes of
+// both organisms are expected to be in increasing innovation order.
+func alignGenes(a, b *organism) []genePair {
+	aLen := len(a.genes)
+	bLen := len(b.genes)
+
+	pairs := make([]genePair, 0, max(aLen, bLen))
+
+	for aIdx, bIdx := 0, 0; aIdx < aLen || bIdx < bLen; {
+		switch {
+		case aIdx == aLen:
+			// Genes beyond the end of a are excess genes
+			pairs = append(pairs, genePair{b: b.genes[bIdx], alignment: excessGene})
 			bIdx++
+		case bIdx == bLen:
+			// Genes beyond the end of b are excess genes
+			pairs = append(pairs, genePair{a: a.genes[aIdx], alignment: excessGene})
+			aIdx++
+		default:
+			aGene := a.genes[aIdx]
+			bGene := b.genes[bIdx]
+			aInov := aGene.getInnovation()
+			bInov := bGene.getInnovation()
+
+			if aInov == bInov {
+				pairs = append(pairs, genePair{aGene, bGene, matchingGenes})
+				aIdx++
+				bIdx++
+			} else if aInov < bInov {
+				pairs = append(pairs, genePair{a: aGene, alignment: disjointGene})
+				aIdx++
+			} else {
+				pairs = append(pairs, genePair{b: bGene, alignment: disjointGene})
+				bIdx++
+			}
+		}
+	}
+
+	return pairs
+}
+
+// Calculate the genetic distance between two organisms
+func geneticDistance(a, b *organism) distance {
+	d := distance{nbrGenes: max(len(a.genes), len(b.genes))}
+
+	var matching int
+	var weightDiff float64
+
+	for _, pair := range alignGenes(a, b) {
+		switch pair.alignment {
+		case matchingGenes:
+			// Only synapses carry a weight
+			aSyn, aOk := pair.a.(*synapse)
+			bSyn, bOk := pair.b.(*synapse)
+			if aOk && bOk {
+				weightDiff += math.Abs(aSyn.weight - bSyn.weight)
+				matching++
+			}
+		case disjointGene:
+			d.disjoint++
+		case excessGene:
+			d.excess++
+		}
+	}
+
+	if matching > 0 {
+		d.weightDiff = weightDiff / float64(matching)
+	}
+
+	return d
+}
+
+// The compatibility distance, d = (c1 * E + c2 * D) / N + c3 * W
+func (d distance) compatibility(c SpeciesConfig) float64 {
+	n := math.Max(1, float64(d.nbrGenes))
+
+	return (c.ExcessGenesCoeff*float64(d.excess)+
+		c.DisjoinGenesCoeff*float64(d.disjoint))/n +
+		c.AvgWeightDiffCoeff*d.weightDiff
+}
+
+// The compatibility distance between two organisms using the global
+// species configuration
+func compatibilityDistance(a, b *organism) float64 {
+	return geneticDistance(a, b).compatibility(config.SpeciesConfig)
+}
+
+// The compatibility distance between two organisms, the distance used to
+// decide if they belong to the same species. Useful to cluster organisms
+// outside of the built-in speciation.
+func CompatibilityDistance(a, b *organism, cfg SpeciesConfig) float64 {
+	return geneticDistance(a, b).compatibility(cfg)
+}
+
+// Mate two organism producing an offspring with the combined topology
+// of its parents.
+func mate(a, b *organism) *organism {
+	if len(a.sensors) != len(b.sensors) ||
+		len(a.outputs) != len(b.outputs) {
+		log.Fatal("Wooooh easy there fella' that's illegal")
+	}
 
+	// Create an empty offspring
+	offspring := _newOrganism(len(a.sensors), len(a.outputs))
+	offspring.generation = a.generation + 1
+
+	// Line up the genes and start building the new topology
+	for _, pair := range alignGenes(a, b) {
+		// This is what the child will inherit
+		var inheritance gene
+
+		if pair.alignment == matchingGenes {
+			// If these are the same genes inherit from the fittest parent,
+			// unless only the other parent has locked the gene
+			if isLocked(pair.a) != isLocked(pair.b) {
+				if isLocked(pair.a) {
+					inheritance = pair.a
+				} else {
+					inheritance = pair.b
+				}
+			} else if fitter(a, b) {
+				inheritance = pair.a
+			} else {
+				inheritance = pair.b
+			}
+		} else if pair.a != nil {
+			// Disjoint and excess genes are inherited from the parent
+			// that has them
+			inheritance = pair.a
 		} else {
-			log.Fatal("Out of genes but haven't reached end of genes")
+			inheritance = pair.b
 		}
 
 		// Now insert the inherited gene into the offspring
@@ -431,46 +1404,434 @@ func mate(a, b *organism) *organism {
 		case *synapse:
 			copySynapse := *g
 			offspring.addSynapse(&copySynapse)
+		case CustomGene:
+			offspring.AddCustomGene(g)
 		}
 	}
 
+	// Parents with very different weight scales produce offspring with
+	// mixed scales
+	if config.OrganismConfig.NormalizeWeightsAfterMating {
+		offspring.NormalizeWeights()
+	}
+
 	return offspring
 }
 
-// Feed a new slice of inputs to the organism
+// Mate any number of organisms producing an offspring with the combined
+// topology of its parents. Every gene of a parent is inherited from one of
+// the parents that have it, picked at random with a probability
+// proportional to the parent's fitness. Negative fitnesses are shifted like
+// in AllocateOffspring so that the least fit parent keeps a small chance.
+func MateMany(parents []*organism) (*organism, error) {
+	if len(parents) == 0 {
+		return nil, errors.New("No parents")
+	}
+
+	generation := 0
+	for _, p := range parents {
+		if len(p.sensors) != len(parents[0].sensors) ||
+			len(p.outputs) != len(parents[0].outputs) {
+			return nil, errors.New("Parents have different numbers of inputs or outputs")
+		}
+		generation = max(generation, p.generation)
+	}
+
+	fitness := make([]float64, len(parents))
+	for i, p := range parents {
+		fitness[i] = p.fitness
+	}
+	fitness = positiveFitness(fitness)
+
+	weights := make(map[*organism]float64, len(parents))
+	for i, p := range parents {
+		weights[p] = fitness[i]
+	}
+
+	// The parents' genes by innovation number
+	pool := make(map[uint64][]gene)
+	owners := make(map[uint64][]*organism)
+	for _, p := range parents {
+		for _, g := range p.genes {
+			innovation := g.getInnovation()
+			pool[innovation] = append(pool[innovation], g)
+			owners[innovation] = append(owners[innovation], p)
+		}
+	}
+
+	innovations := make([]uint64, 0, len(pool))
+	for innovation := range pool {
+		innovations = append(innovations, innovation)
+	}
+	sort.Slice(innovations, func(i, j int) bool {
+		return innovations[i] < innovations[j]
+	})
+
+	offspring := _newOrganism(len(parents[0].sensors), len(parents[0].outputs))
+	offspring.generation = generation + 1
+
+	for _, innovation := range innovations {
+		genes := pool[innovation]
+
+		total := 0.0
+		for _, p := range owners[innovation] {
+			total += weights[p]
+		}
+
+		inheritance := genes[randIntn(len(genes))]
+		if total > 0 {
+			r := RandFloat64() * total
+			for i, p := range owners[innovation] {
+				r -= weights[p]
+				if r < 0 {
+					inheritance = genes[i]
+					break
+				}
+			}
+		}
+
+		switch g := inheritance.(type) {
+		case *neuron:
+			offspring.addNeuron(g.clone())
+		case *synapse:
+			offspring.addSynapse(g.clone())
+		case CustomGene:
+			offspring.AddCustomGene(g)
+		}
+	}
+
+	return offspring, nil
+}
+
+// Feed a new slice of inputs to the organism and return the output.
+// Returns an error if the number of inputs doesn't match the number of
+// sensors or the signals can't be propagated through the network.
+func (org *organism) Process(input []float64) ([]float64, error) {
+	return org.activation().Process(input)
+}
+
+// Feed a new slice of inputs to the organism like Process but panic on
+// errors, for networks that are known to be well formed, e.g. evolved ones
 func (org *organism) process(input []float64) []float64 {
-	if len(input) != len(org.sensors) {
-		log.Fatal("Number of inputs exceeds number of sensors")
+	out, err := org.Process(input)
+	if err != nil {
+		panic(err)
 	}
 
+	return out
+}
+
+// Clear the neurons and add the input signals to the sensors
+func (a *Activation) feed(input []float64) {
+	a.allocate()
+
 	// Clear all neurons
-	for _, neuron := range org.neurons {
+	for i := range a.states {
+		state := &a.states[i]
+
 		// Set the current sum equal to the recursive inputs from
 		// the previous iteration
-		neuron.sum, neuron.future = neuron.future, 0
+		state.sum, state.future = state.future, 0
 
-		neuron.visited = false
-		neuron.seen = false
+		state.visited = false
+		state.seen = false
 	}
 
 	// Add the input signals to the sensor neurons
-	for i, id := range org.sensors {
-		s := org.neurons[id]
-		s.sum += input[i]
+	for i, id := range a.org.sensors {
+		a.state(id).sum += input[i]
 	}
+}
 
-	org.propagate()
+// Feed a new slice of inputs to the organism and give up propagating the
+// signals once the timeout has passed. Returns the output and whether the
+// propagation finished, outputs that weren't reached before the timeout
+// are zero. The signals travel the same way as in Process. Returns nil and
+// false where Process returns an error, e.g. for the wrong number of
+// inputs.
+func (org *organism) ProcessWithTimeout(input []float64, timeout time.Duration) ([]float64, bool) {
+	if len(input) != len(org.sensors) {
+		return nil, false
+	}
+
+	a := org.activation()
+	a.feed(input)
+	finished, err := a.propagateBy(time.Now().Add(timeout))
+	if err != nil {
+		return nil, false
+	}
 
 	out := make([]float64, len(org.outputs))
 	for i, id := range org.outputs {
-		out[i] = org.neurons[id].value
+		if state := a.state(id); state.visited {
+			out[i] = state.value
+		}
+	}
+
+	return out, finished
+}
+
+// Feed a batch of inputs to the organism one after the other and return
+// the output for each. The state of a recurrent network carries over from
+// one input to the next.
+func (org *organism) ProcessBatch(inputs [][]float64) [][]float64 {
+	return org.processBatch(inputs, nil)
+}
+
+// Process a batch of inputs calling observe, if not nil, after each input
+// has been propagated through the network
+func (org *organism) processBatch(inputs [][]float64, observe func()) [][]float64 {
+	outputs := make([][]float64, len(inputs))
+	for i, input := range inputs {
+		outputs[i] = org.process(input)
+		if observe != nil {
+			observe()
+		}
+	}
+
+	return outputs
+}
+
+// The fraction of a batch of inputs for which the signal carried by each
+// enabled synapse, the sending neuron's output times the weight, exceeds
+// the threshold
+func (org *organism) SynapseActivationFrequency(inputs [][]float64, threshold float64) map[synapseID]float64 {
+	counts := make(map[synapseID]int)
+	org.processBatch(inputs, func() {
+		for id, s := range org.synapses {
+			if s.enabled && org.state(s.in).value*s.weight > threshold {
+				counts[id]++
+			}
+		}
+	})
+
+	frequency := make(map[synapseID]float64)
+	for id, s := range org.synapses {
+		if s.enabled && len(inputs) > 0 {
+			frequency[id] = float64(counts[id]) / float64(len(inputs))
+		}
+	}
+
+	return frequency
+}
+
+// Does the output depend on the input, i.e. does any output vary by more
+// than a variance of 1e-9 over the sample inputs. An organism without
+// enabled synapses or with only zero weights gives the same output for
+// every input.
+func (org *organism) IsNonTrivial(sampleInputs [][]float64) bool {
+	if len(sampleInputs) == 0 {
+		return false
+	}
+
+	org.resetStates()
+	outputs := org.ProcessBatch(sampleInputs)
+	org.resetStates()
+
+	n := float64(len(outputs))
+	for i := range org.outputs {
+		var mean float64
+		for _, out := range outputs {
+			mean += out[i] / n
+		}
+
+		var variance float64
+		for _, out := range outputs {
+			variance += (out[i] - mean) * (out[i] - mean) / n
+		}
+
+		if variance > 1e-9 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The enabled synapse the organism depends on the most. Each synapse in
+// turn is disabled by zeroing its weight and the organism is run on the
+// inputs, eval turns the outputs for an input into a score. The synapse
+// whose absence gives the largest total squared difference to the scores
+// of the intact organism is returned, zero if there are no enabled
+// synapses.
+func (org *organism) MostInfluentialSynapse(inputs [][]float64, eval func([]float64) float64) synapseID {
+	scores := func() []float64 {
+		org.resetStates()
+
+		result := make([]float64, len(inputs))
+		for i, output := range org.ProcessBatch(inputs) {
+			result[i] = eval(output)
+		}
+		return result
+	}
+
+	baseline := scores()
+
+	var best synapseID
+	bestError := -1.0
+	for _, g := range org.genes {
+		s, ok := g.(*synapse)
+		if !ok || !s.enabled {
+			continue
+		}
+
+		weight := s.weight
+		s.weight = 0
+		var sqError float64
+		for i, score := range scores() {
+			sqError += (score - baseline[i]) * (score - baseline[i])
+		}
+		s.weight = weight
+
+		if sqError > bestError {
+			best = s.id
+			bestError = sqError
+		}
+	}
+
+	org.resetStates()
+
+	return best
+}
+
+// Feed a new slice of inputs to the organism, evaluating the neurons in
+// topological order. Unlike process every neuron receives all feedforward
+// signals before it fires, the signals of recurrent synapses arrive at the
+// next input. Panics on errors like process.
+func (org *organism) processFeedforward(input []float64) []float64 {
+	out, err := org.activation().processTopological(input, false)
+	if err != nil {
+		panic(err)
 	}
 
 	return out
 }
 
-// Propagate signals through the organismt network toplogy
-func (org *organism) propagate() {
+// Feed a new slice of inputs to the organism as if its recurrent synapses
+// were absent, a single pass over the feedforward synapses in topological
+// order. Nothing carries over from one input to the next, which makes this
+// a fast and stateless way to run a recurrent network once it has been
+// evolved. Returns an error if the number of inputs doesn't match the
+// number of sensors.
+func (org *organism) ProcessFeedforwardOnly(input []float64) ([]float64, error) {
+	return org.activation().processTopological(input, true)
+}
+
+// Evaluate the neurons in topological order, the signals of recurrent
+// synapses either arrive at the next input or are ignored, and then apply
+// the custom genes
+func (a *Activation) processTopological(input []float64, ignoreRecurrent bool) ([]float64, error) {
+	org := a.org
+	if len(input) != len(org.sensors) {
+		return nil, errors.New("Number of inputs exceeds number of sensors")
+	}
+
+	order, recurrent := org.topologicalOrder()
+
+	// Forget the recurrent signals of the previous input
+	if ignoreRecurrent {
+		a.allocate()
+		for i := range a.states {
+			a.states[i].future = 0
+		}
+	}
+	a.feed(input)
+
+	for _, id := range order {
+		n := a.state(id)
+		n.value = org.neurons[id].activate(n.sum)
+
+		for _, sid := range org.connections[id] {
+			s := org.synapses[sid]
+			if !s.enabled {
+				continue
+			}
+
+			out := a.state(s.out)
+			if !recurrent[sid] {
+				out.sum += n.value * s.weight
+			} else if !ignoreRecurrent {
+				out.future += n.value * s.weight
+			}
+		}
+	}
+
+	if err := a.applyCustomGenes(); err != nil {
+		return nil, err
+	}
+
+	out := make([]float64, len(org.outputs))
+	for i, id := range org.outputs {
+		out[i] = a.state(id).value
+	}
+
+	return out, nil
+}
+
+// Propagate signals through the organismt network toplogy and then apply
+// the custom genes
+func (a *Activation) propagate() error {
+	_, err := a.propagateBy(time.Time{})
+	return err
+}
+
+// Propagate signals until the deadline, a zero deadline means no deadline,
+// and apply the custom genes. Returns false if the deadline passed before
+// all neurons were reached.
+func (a *Activation) propagateBy(deadline time.Time) (bool, error) {
+	// Feedforward networks are evaluated in topological order in their
+	// compressed form, recurrent networks are traversed breadth first
+	var finished bool
+	if _, recurrent := a.org.topologicalOrder(); len(recurrent) == 0 {
+		finished = a.propagateCSR(deadline)
+	} else {
+		var err error
+		if finished, err = a.propagateUntil(deadline); err != nil {
+			return false, err
+		}
+	}
+
+	return finished, a.applyCustomGenes()
+}
+
+// Propagate signals through a feedforward network with the graph in
+// compressed sparse row form. The rows are in topological order so every
+// neuron receives the signals of all of its inputs before it fires, however
+// deep they are. Returns false if the deadline, unless zero, passed before
+// all neurons were reached.
+func (a *Activation) propagateCSR(deadline time.Time) bool {
+	org := a.org
+	if org.csr == nil {
+		g := org.buildCSR()
+		org.csr = &g
+	}
+	g := org.csr
+
+	for row, id := range g.neurons {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return false
+		}
+
+		state := a.state(id)
+		state.visited = true
+		state.value = org.neurons[id].activate(state.sum)
+
+		for _, sid := range g.colIdx[g.rowPtr[row]:g.rowPtr[row+1]] {
+			synapse := org.synapses[sid]
+			if synapse.enabled {
+				a.state(synapse.out).sum += state.value * synapse.weight
+			}
+		}
+	}
+
+	return true
+}
+
+// Propagate signals until the deadline, a zero deadline means no deadline.
+// Returns false if the deadline passed before all neurons were reached.
+func (a *Activation) propagateUntil(deadline time.Time) (bool, error) {
+	org := a.org
+
 	// Queue used for breadth first traversal of the network
 	queue := newsqueue()
 
@@ -482,18 +1843,24 @@ func (org *organism) propagate() {
 	// Iterate as long as there are unprocessed nueurons in the queue
 	for queue.Size() > 0 {
 
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return false, nil
+		}
+
 		// Pop the queue
 		n := queue.Pop().(*neuron)
+		state := a.state(n.id)
 
-		// This neuron has already been traversed...
-		if n.visited {
-			// ...and this situation cannot occur unless there's a bug
-			log.Fatal("Found visited neuron, ", n, ", in the queue")
+		// This neuron has already been traversed, a synapse reached a
+		// sensor before the sensor fired. Mutations never connect synapses
+		// to sensors but a hand built or loaded genome can.
+		if state.visited {
+			return false, fmt.Errorf("Found visited neuron %d in the queue", n.id)
 		}
 
 		// Tag the neuron as visited and calculate the output value
-		n.visited = true
-		n.value = config.OrganismConfig.actFunc(n.sum)
+		state.visited = true
+		state.value = n.activate(state.sum)
 
 		// Propagate the output value through the synapses
 		for _, id := range org.connections[n.id] {
@@ -501,8 +1868,8 @@ func (org *organism) propagate() {
 
 			if synapse.enabled {
 
-				signal := n.value * synapse.weight
-				out := org.neurons[synapse.out]
+				signal := state.value * synapse.weight
+				out := a.state(synapse.out)
 
 				if out.visited {
 					// If the attached neuron has already been visited then
@@ -519,10 +1886,12 @@ func (org *organism) propagate() {
 					// the same neuron twice.
 					if !out.seen {
 						out.seen = true
-						queue.Push(out)
+						queue.Push(org.neurons[synapse.out])
 					}
 				}
 			}
 		}
 	}
+
+	return true, nil
 }
@@ -1,8 +1,12 @@
 package neat
 
 import (
+	"math"
 	"os"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,7 +22,7 @@ var testConfig = NeatConfig{
 	OrganismConfig: OrganismConfig{
 		SynapseSplitMutProb: 0.01,
 		SynapseActivityMutProb: 0.01,
-		SynapseWeightMutProp: 0.01,
+		SynapseWeightMutProb: 0.01,
 		SynapseWeightBound: 5.0,
 		actFunc: identity,
 	},
@@ -168,6 +172,157 @@ func TestSplitSynapse(t *testing.T) {
 	require.Equal(t, synapse3.out, output.id, "")
 }
 
+func TestLockGene(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 1
+		c.OrganismConfig.SynapseWeightMutProb = 1
+		c.OrganismConfig.SynapseAddMutProb = 1
+	})
+
+	org := newOrganism(2, 2)
+	locked := org.getSynapse(org.connections[org.sensors[0]][0])
+	locked.weight = 0.25
+	org.LockGene(locked.innovation)
+
+	unlocked := org.getSynapse(org.connections[org.sensors[1]][0])
+
+	for i := 0; i < 1000; i++ {
+		org.mutate()
+	}
+
+	require.Equal(t, 0.25, locked.weight, "")
+	require.True(t, locked.enabled, "")
+	require.NotEqual(t, 1.0, unlocked.weight, "")
+
+	// Splitting doubles the number of synapses every mutation so only a
+	// few mutations are run with splitting enabled
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 1
+		c.OrganismConfig.SynapseActivityMutProb = 1
+		c.OrganismConfig.SynapseWeightMutProb = 1
+	})
+	for i := 0; i < 5; i++ {
+		org.mutate()
+	}
+
+	// A split would have disabled the locked synapse
+	require.Equal(t, 0.25, locked.weight, "")
+	require.True(t, locked.enabled, "")
+
+	// The lock survives cloning
+	require.True(t, org.clone().getSynapse(locked.id).locked, "")
+	org.UnlockGene(locked.innovation)
+	require.False(t, locked.locked, "")
+}
+
+func TestLockedSubnetworkIsFrozen(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 1
+		c.OrganismConfig.SynapseWeightMutProb = 1
+		c.OrganismConfig.SynapseAddMutProb = 1
+		c.OrganismConfig.NormalizeWeightsAfterMating = true
+	})
+
+	org := createRandomOrganism(2, 2, 3, 2)
+
+	// Freeze everything leaving the first sensor: the synapses and the
+	// neurons they lead to
+	var frozen []gene
+	for _, id := range org.connections[org.sensors[0]] {
+		s := org.getSynapse(id)
+		frozen = append(frozen, s, org.neurons[s.out])
+	}
+	snapshot := make(map[uint64]interface{})
+	for _, g := range frozen {
+		org.LockGene(g.getInnovation())
+		switch g := g.(type) {
+		case *neuron:
+			snapshot[g.innovation] = *g
+		case *synapse:
+			snapshot[g.innovation] = *g
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		org.mutate()
+	}
+
+	// Mate with an unlocked and mutated copy that is fitter, the child
+	// still inherits the frozen genes
+	other := org.clone()
+	for _, g := range frozen {
+		other.UnlockGene(g.getInnovation())
+	}
+	for i := 0; i < 10; i++ {
+		other.mutate()
+	}
+	other.fitness = org.fitness + 1
+	child := mate(org, other)
+
+	for _, o := range []*organism{org, child} {
+		found := 0
+		for _, g := range o.genes {
+			want, ok := snapshot[g.getInnovation()]
+			if !ok {
+				continue
+			}
+			found++
+
+			switch g := g.(type) {
+			case *neuron:
+				require.Equal(t, want, *g, "")
+			case *synapse:
+				require.Equal(t, want, *g, "")
+			}
+		}
+		require.Equal(t, len(snapshot), found, "")
+	}
+}
+
+func TestFullyConnectedOrganism(t *testing.T) {
+	org := newFullyConnectedOrganism(3, 2)
+	require.Equal(t, 6, len(org.synapses), "")
+
+	type pair struct{ in, out neuronID }
+	pairs := make(map[pair]bool)
+	innovations := make(map[uint64]bool)
+	for _, s := range org.synapses {
+		pairs[pair{s.in, s.out}] = true
+		innovations[s.innovation] = true
+	}
+	require.Equal(t, 6, len(pairs), "")
+	require.Equal(t, 6, len(innovations), "")
+
+	for _, in := range org.sensors {
+		for _, out := range org.outputs {
+			require.True(t, pairs[pair{in, out}], "")
+		}
+	}
+}
+
+func TestSortGenes(t *testing.T) {
+	org := newOrganism(2, 2)
+	org.splitSynapse(org.genes[4].(*synapse).id)
+	require.True(t, org.GenomeIsSorted(), "")
+
+	// Reverse the genes as if loaded from an unordered source
+	for i, j := 0, len(org.genes)-1; i < j; i, j = i+1, j-1 {
+		org.genes[i], org.genes[j] = org.genes[j], org.genes[i]
+	}
+	require.False(t, org.GenomeIsSorted(), "")
+
+	org.SortGenes()
+	require.True(t, org.GenomeIsSorted(), "")
+	require.Equal(t, 9, len(org.genes), "")
+	for i := 1; i < len(org.genes); i++ {
+		require.True(t, org.genes[i-1].getInnovation() < org.genes[i].getInnovation(), "")
+	}
+}
+
 func TestOrganismClone(t *testing.T) {
 	a := createSimpleRecurrent()
 	b := a.clone()
@@ -203,3 +358,1101 @@ func TestMating(t *testing.T) {
 
 	t.Log(offspring)
 }
+
+// Innovation numbers must be unique even when handed out concurrently
+func TestNextInnovationConcurrent(t *testing.T) {
+	nRoutines := 100
+
+	innovations := make(chan uint64, nRoutines)
+	var wg sync.WaitGroup
+	for i := 0; i < nRoutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			innovations <- nextInnovation()
+		}()
+	}
+	wg.Wait()
+	close(innovations)
+
+	seen := make(map[uint64]bool)
+	for innovation := range innovations {
+		require.False(t, seen[innovation], "duplicate innovation number")
+		seen[innovation] = true
+	}
+
+	require.Equal(t, nRoutines, len(seen), "")
+}
+
+func TestMaxConnectionDensity(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.MaxConnectionDensity = 0.5
+	})
+
+	// Four neurons, two synapses and room for twelve
+	org := newOrganism(2, 2)
+	require.Equal(t, 2.0/12.0, org.ConnectionDensity(), "")
+
+	// Fill the organism to capacity
+	added := 0
+	for i := 0; i < 20; i++ {
+		if org.addConnection() {
+			added++
+		}
+	}
+
+	require.Equal(t, 4, added, "")
+	require.Equal(t, 6, len(org.synapses), "")
+	require.Equal(t, 0.5, org.ConnectionDensity(), "")
+
+	// The organism is at capacity, mutations must not add synapses
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.MaxConnectionDensity = 0.5
+		c.OrganismConfig.SynapseAddMutProb = 1
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+	})
+	for i := 0; i < 20; i++ {
+		org.mutate()
+	}
+	require.Equal(t, 6, len(org.synapses), "")
+}
+
+func TestAddConnection(t *testing.T) {
+	org := newOrganism(2, 2)
+
+	// Without a density limit every neuron can be connected to the
+	// 2 outputs, 4 * 2 pairs less the 2 outputs connected to themselves
+	for org.addConnection() {
+	}
+
+	require.Equal(t, 6, len(org.synapses), "")
+	for _, s := range org.synapses {
+		require.NotEqual(t, sensorNeuron, org.neurons[s.out].kind, "")
+	}
+}
+
+func TestAddConnectionProcess(t *testing.T) {
+	withSeed(t, 1)
+
+	// Synapses into sensors would make a neuron reachable twice and
+	// break the propagation
+	for i := 0; i < 200; i++ {
+		org := newOrganism(3, 2)
+		org.splitSynapse(org.connections[org.sensors[0]][0])
+		for j := 0; j < 6; j++ {
+			org.addConnection()
+		}
+
+		_, err := org.Process([]float64{1, 2, 3})
+		require.NoError(t, err, "")
+	}
+}
+
+func TestSetWeights(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.Equal(t, []float64{2}, org.process([]float64{1, 1}), "")
+
+	weights := make(map[synapseID]float64)
+	for i, id := range org.sensors {
+		weights[org.connections[id][0]] = float64(i + 2)
+	}
+	require.NoError(t, org.SetWeights(weights), "")
+	require.Equal(t, []float64{5}, org.process([]float64{1, 1}), "")
+
+	// Unknown synapses are rejected without touching the known ones
+	weights[synapseID(nextID())] = 0
+	for id := range weights {
+		weights[id] = 0
+	}
+	require.Error(t, org.SetWeights(weights), "")
+	require.Equal(t, []float64{5}, org.process([]float64{1, 1}), "")
+}
+
+func TestQuantizeWeights(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) { c.OrganismConfig.actFunc = Sigmoid })
+
+	org := createFeedforwardOrganism(3, 2, 6)
+	quantized := org.clone()
+	maxError := quantized.QuantizeWeights(8)
+
+	// Half a step of the 255 steps spanning the bound
+	step := 2 * testConfig.OrganismConfig.SynapseWeightBound / 255
+	require.True(t, maxError <= step/2+1e-9, "")
+
+	for _, s := range quantized.synapses {
+		level := (s.weight + testConfig.OrganismConfig.SynapseWeightBound) / step
+		require.InDelta(t, math.Round(level), level, 1e-9, "")
+		require.InDelta(t, org.synapses[s.id].weight, s.weight, maxError+1e-9, "")
+	}
+
+	for i := 0; i < 10; i++ {
+		input := []float64{RandFloat64(), RandFloat64(), RandFloat64()}
+		expected := org.process(input)
+		for j, output := range quantized.process(input) {
+			require.InDelta(t, expected[j], output, 0.05, "")
+		}
+	}
+
+	// A single bit leaves only the bounds
+	quantized.QuantizeWeights(1)
+	for _, s := range quantized.synapses {
+		require.Equal(t, testConfig.OrganismConfig.SynapseWeightBound, math.Abs(s.weight), "")
+	}
+}
+
+func TestNormalizeWeights(t *testing.T) {
+	org := newOrganism(3, 1)
+	weights := []float64{0.5, -2, 1}
+	for i, sensor := range org.sensors {
+		org.synapses[org.connections[sensor][0]].weight = weights[i]
+	}
+
+	org.NormalizeWeights()
+
+	// The weights keep their relative sizes, the largest is at the bound
+	for i, sensor := range org.sensors {
+		weight := org.synapses[org.connections[sensor][0]].weight
+		require.InDelta(t, weights[i]*2.5, weight, 1e-9, "")
+	}
+
+	// Offspring are normalized when mating if configured to
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.NormalizeWeightsAfterMating = true
+	})
+	a := newOrganism(3, 1)
+	b := a.clone()
+	for _, g := range b.genes {
+		if s, ok := g.(*synapse); ok {
+			s.weight *= 100
+		}
+	}
+
+	offspring := mate(a, b)
+	var largest float64
+	for _, s := range offspring.synapses {
+		largest = math.Max(largest, math.Abs(s.weight))
+	}
+	require.InDelta(t, config.OrganismConfig.SynapseWeightBound, largest, 1e-9, "")
+}
+
+func TestWeightHistogram(t *testing.T) {
+	org := newOrganism(100, 100)
+	require.Equal(t, 100, len(org.synapses), "")
+
+	// Spread the weights evenly over [-5, 5), ten to each bucket, and
+	// disable every tenth synapse
+	i := 0
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok {
+			s.weight = -5 + 0.1*float64(i) + 0.05
+			s.enabled = i%10 != 0
+			i++
+		}
+	}
+
+	buckets, counts := org.WeightHistogram(10)
+	require.Equal(t, 10, len(buckets), "")
+	require.InDelta(t, -4.5, buckets[0], 1e-9, "")
+	require.InDelta(t, 4.5, buckets[9], 1e-9, "")
+
+	sum := 0
+	for _, c := range counts {
+		require.Equal(t, 9, c, "")
+		sum += c
+	}
+	require.Equal(t, org.enabledSynapses(), sum, "")
+
+	for _, n := range []int{0, -1} {
+		buckets, counts = org.WeightHistogram(n)
+		require.Equal(t, 0, len(buckets), "")
+		require.Equal(t, 0, len(counts), "")
+	}
+}
+
+// Create an organism with hidden neurons with the given innovation numbers
+func createGenome(innovations ...uint64) *organism {
+	org := _newOrganism(0, 0)
+	for _, innovation := range innovations {
+		n := newHiddenNeuron()
+		n.innovation = innovation
+		org.addNeuron(n)
+	}
+
+	return org
+}
+
+// The innovation numbers and alignment of aligned genes, zero for a
+// missing gene
+func alignmentOf(pairs []genePair) [][3]uint64 {
+	var result [][3]uint64
+	for _, pair := range pairs {
+		var aInov, bInov uint64
+		if pair.a != nil {
+			aInov = pair.a.getInnovation()
+		}
+		if pair.b != nil {
+			bInov = pair.b.getInnovation()
+		}
+		result = append(result, [3]uint64{aInov, bInov, uint64(pair.alignment)})
+	}
+
+	return result
+}
+
+func TestAlignGenes(t *testing.T) {
+	m := uint64(matchingGenes)
+	d := uint64(disjointGene)
+	e := uint64(excessGene)
+
+	tests := []struct {
+		name     string
+		a        *organism
+		b        *organism
+		expected [][3]uint64
+	}{
+		{
+			"identical",
+			createGenome(1, 2, 3),
+			createGenome(1, 2, 3),
+			[][3]uint64{{1, 1, m}, {2, 2, m}, {3, 3, m}},
+		},
+		{
+			"empty",
+			createGenome(),
+			createGenome(1, 2),
+			[][3]uint64{{0, 1, e}, {0, 2, e}},
+		},
+		{
+			"excess in a",
+			createGenome(1, 2, 3, 4),
+			createGenome(1, 2),
+			[][3]uint64{{1, 1, m}, {2, 2, m}, {3, 0, e}, {4, 0, e}},
+		},
+		{
+			"disjoint",
+			createGenome(1, 3, 5),
+			createGenome(1, 2, 5),
+			[][3]uint64{{1, 1, m}, {0, 2, d}, {3, 0, d}, {5, 5, m}},
+		},
+		{
+			"disjoint and excess",
+			createGenome(1, 4, 6, 7),
+			createGenome(2, 4, 5),
+			[][3]uint64{{1, 0, d}, {0, 2, d}, {4, 4, m}, {0, 5, d}, {6, 0, e}, {7, 0, e}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, alignmentOf(alignGenes(test.a, test.b)), "")
+		})
+	}
+}
+
+func TestGeneticDistance(t *testing.T) {
+	a := createGenome(1, 4, 6, 7)
+	b := createGenome(2, 4, 5)
+
+	d := geneticDistance(a, b)
+	require.Equal(t, 2, d.excess, "")
+	require.Equal(t, 3, d.disjoint, "")
+	require.Equal(t, 4, d.nbrGenes, "")
+	require.Equal(t, 0.0, d.weightDiff, "")
+}
+
+// Add a synapse with the given innovation and weight between the first
+// two neurons of the organism
+func addWeightedSynapse(org *organism, innovation uint64, weight float64) {
+	in := org.genes[0].(*neuron)
+	out := org.genes[1].(*neuron)
+	s := newSynapse(in, out)
+	s.innovation = innovation
+	s.weight = weight
+	org.addSynapse(s)
+}
+
+func TestCompatibilityDistance(t *testing.T) {
+	a := createGenome(1, 4, 6, 7)
+	addWeightedSynapse(a, 10, 0.5)
+	addWeightedSynapse(a, 11, 2)
+
+	b := createGenome(2, 4, 5)
+	addWeightedSynapse(b, 10, 1.5)
+
+	cfg := SpeciesConfig{
+		ExcessGenesCoeff:   1,
+		DisjoinGenesCoeff:  2,
+		AvgWeightDiffCoeff: 0.5,
+	}
+
+	// E = 1 (11), D = 5 (1, 2, 5, 6, 7), N = 6, W = |0.5 - 1.5| = 1
+	expected := (1*1+2*5)/6.0 + 0.5*1
+	require.InDelta(t, expected, CompatibilityDistance(a, b, cfg), 1e-9, "")
+	require.InDelta(t, expected, CompatibilityDistance(b, a, cfg), 1e-9, "")
+	require.Equal(t, 0.0, CompatibilityDistance(a, a, cfg), "")
+}
+
+// Mating genomes of very different lengths must inherit every gene of
+// the parents exactly once
+func TestMatingDifferentLengths(t *testing.T) {
+	a := newOrganism(2, 2)
+	b := a.clone()
+
+	// Grow b far beyond a
+	for i := 0; i < 10; i++ {
+		for _, g := range b.genes {
+			if s, ok := g.(*synapse); ok && s.enabled {
+				b.splitSynapse(s.id)
+				break
+			}
+		}
+	}
+	require.True(t, len(b.genes) > 3*len(a.genes), "")
+
+	for _, parents := range [][2]*organism{{a, b}, {b, a}} {
+		offspring := mate(parents[0], parents[1])
+
+		inherited := make(map[uint64]int)
+		for _, g := range offspring.genes {
+			inherited[g.getInnovation()]++
+		}
+
+		for _, parent := range parents {
+			for _, g := range parent.genes {
+				require.Equal(t, 1, inherited[g.getInnovation()], "")
+			}
+		}
+
+		require.Equal(t, len(b.genes), len(offspring.genes), "")
+		require.Equal(t, len(b.neurons), len(offspring.neurons), "")
+		require.Equal(t, len(b.synapses), len(offspring.synapses), "")
+	}
+}
+
+func TestMateMany(t *testing.T) {
+	withSeed(t, 1)
+
+	// Three parents with the same initial synapses, told apart by their
+	// weights, and a gene of their own each
+	base := newOrganism(2, 2)
+	parents := make([]*organism, 3)
+	for i := range parents {
+		parents[i] = base.clone()
+		parents[i].fitness = float64(i + 1)
+		for _, s := range parents[i].synapses {
+			s.weight = float64(i)
+		}
+		parents[i].splitSynapse(parents[i].genes[4].(*synapse).id)
+	}
+
+	innovations := make(map[uint64]bool)
+	for _, p := range parents {
+		for _, g := range p.genes {
+			innovations[g.getInnovation()] = true
+		}
+	}
+
+	contributed := make(map[float64]bool)
+	for i := 0; i < 100; i++ {
+		offspring, err := MateMany(parents)
+		require.NoError(t, err, "")
+		require.Equal(t, len(innovations), len(offspring.genes), "")
+
+		for _, g := range offspring.genes {
+			require.True(t, innovations[g.getInnovation()], "")
+		}
+
+		s := offspring.genes[5].(*synapse)
+		contributed[s.weight] = true
+	}
+	require.Equal(t, 3, len(contributed), "")
+
+	// With negative fitnesses the least negative parent still contributes
+	// the most genes
+	counts := make(map[float64]int)
+	for i, p := range parents {
+		p.fitness = float64(i - 3)
+	}
+	for i := 0; i < 300; i++ {
+		offspring, err := MateMany(parents)
+		require.NoError(t, err, "")
+		counts[offspring.genes[5].(*synapse).weight]++
+	}
+	require.True(t, counts[2] > counts[1] && counts[1] > counts[0], "")
+
+	_, err := MateMany([]*organism{base, newOrganism(1, 2)})
+	require.Error(t, err, "")
+	_, err = MateMany(nil)
+	require.Error(t, err, "")
+}
+
+func TestSynapseActivationFrequency(t *testing.T) {
+	org := newOrganism(2, 1)
+	first := org.connections[org.sensors[0]][0]
+	second := org.connections[org.sensors[1]][0]
+
+	// The first sensor is active for every other input, the second never
+	inputs := make([][]float64, 100)
+	for i := range inputs {
+		inputs[i] = []float64{float64(i % 2), 0}
+	}
+
+	frequency := org.SynapseActivationFrequency(inputs, 0.5)
+	require.InDelta(t, 0.5, frequency[first], 1e-9, "")
+	require.InDelta(t, 0.0, frequency[second], 1e-9, "")
+	require.Equal(t, 2, len(frequency), "")
+
+	// Disabled synapses are left out
+	org.toggleEnabled(second)
+	frequency = org.SynapseActivationFrequency(inputs, 0.5)
+	_, ok := frequency[second]
+	require.False(t, ok, "")
+}
+
+func TestProcessWithTimeout(t *testing.T) {
+	// A long chain of hidden neurons
+	org := newOrganism(1, 1)
+	for i := 0; i < 10000; i++ {
+		org.splitSynapse(org.genes[len(org.genes)-1].(*synapse).id)
+	}
+
+	out, finished := org.ProcessWithTimeout([]float64{1}, time.Microsecond)
+	require.False(t, finished, "")
+	require.Equal(t, []float64{0}, out, "")
+
+	out, finished = org.ProcessWithTimeout([]float64{1}, time.Minute)
+	require.True(t, finished, "")
+	require.Equal(t, []float64{1}, out, "")
+
+	// The wrong number of inputs gives no output
+	out, finished = org.ProcessWithTimeout([]float64{1, 1}, time.Minute)
+	require.False(t, finished, "")
+	require.Nil(t, out, "")
+}
+
+func TestProcessError(t *testing.T) {
+	_, err := newOrganism(2, 1).Process([]float64{1})
+	require.Error(t, err, "")
+
+	// In a recurrent network, which is traversed breadth first, a synapse
+	// from one sensor to the other pushes the second sensor onto the queue
+	// a second time
+	org := newOrganism(2, 1)
+	sensors := []*neuron{org.neurons[org.sensors[0]], org.neurons[org.sensors[1]]}
+	org.addSynapse(newSynapse(sensors[0], sensors[1]))
+	org.addSynapse(newSynapse(org.neurons[org.outputs[0]], org.neurons[org.outputs[0]]))
+	_, recurrent := org.topologicalOrder()
+	require.Equal(t, 1, len(recurrent), "")
+
+	out, err := org.Process([]float64{1, 1})
+	require.Error(t, err, "")
+	require.Nil(t, out, "")
+	out, finished := org.ProcessWithTimeout([]float64{1, 1}, time.Minute)
+	require.False(t, finished, "")
+	require.Nil(t, out, "")
+
+	// process panics rather than exiting
+	require.Panics(t, func() { org.process([]float64{1, 1}) }, "")
+}
+
+func TestIncomingSynapses(t *testing.T) {
+	withSeed(t, 1)
+
+	// The synapses into each neuron found by scanning all synapses
+	requireIncoming := func(org *organism) {
+		for id := range org.neurons {
+			var expected []synapseID
+			for _, g := range org.genes {
+				if s, ok := g.(*synapse); ok && s.out == id {
+					expected = append(expected, s.id)
+				}
+			}
+			require.Equal(t, expected, org.incomingSynapses(id), "")
+		}
+	}
+
+	org := newOrganism(2, 1)
+	output := org.outputs[0]
+	require.Equal(t, 2, len(org.IncomingSynapses(output)), "")
+
+	// Splitting adds a synapse into the output and disables the split one
+	split := org.connections[org.sensors[0]][0]
+	org.splitSynapse(split)
+	requireIncoming(org)
+	require.Equal(t, 3, len(org.IncomingSynapses(output)), "")
+	require.Equal(t, split, org.IncomingSynapses(output)[0], "")
+
+	var hidden neuronID
+	for i := 0; i < 10; i++ {
+		org.splitSynapse(org.incomingSynapses(output)[0])
+		hidden = org.genes[len(org.genes)-3].(*neuron).id
+		org.addConnection()
+		requireIncoming(org)
+	}
+
+	// Removing a neuron removes the synapses into and out of it
+	org.removeNeuron(hidden)
+	requireIncoming(org)
+
+	// The exported list is a copy
+	org.IncomingSynapses(output)[0] = 0
+	require.Equal(t, split, org.incomingSynapses(output)[0], "")
+}
+
+// A random topology grown from a minimal organism by splitting synapses and
+// adding connections
+func createRandomOrganism(nInputs, nOutputs, splits, connections int) *organism {
+	org := newOrganism(nInputs, nOutputs)
+
+	for i := 0; i < splits; i++ {
+		var enabled []*synapse
+		for _, g := range org.genes {
+			if s, ok := g.(*synapse); ok && s.enabled {
+				enabled = append(enabled, s)
+			}
+		}
+		org.splitSynapse(enabled[randIntn(len(enabled))].id)
+	}
+
+	for i := 0; i < connections; i++ {
+		org.addConnection()
+	}
+
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok {
+			s.mutateWeight(config.OrganismConfig.SynapseWeightBound)
+		}
+	}
+
+	return org
+}
+
+// The network sizes used by the benchmarks
+var benchmarkSizes = []struct {
+	name                                   string
+	nInputs, nOutputs, splits, connections int
+}{
+	{"small", 2, 1, 5, 5},
+	{"medium", 8, 4, 30, 30},
+	{"large", 32, 8, 200, 200},
+}
+
+func BenchmarkProcess(b *testing.B) {
+	withSeed(b, 1)
+	withConfig(b, func(c *NeatConfig) { c.OrganismConfig.actFunc = Sigmoid })
+
+	for _, size := range benchmarkSizes {
+		org := createRandomOrganism(size.nInputs, size.nOutputs, size.splits, size.connections)
+		input := make([]float64, size.nInputs)
+		for i := range input {
+			input[i] = RandFloat64()
+		}
+
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				org.process(input)
+			}
+		})
+	}
+}
+
+func BenchmarkMate(b *testing.B) {
+	withSeed(b, 1)
+
+	for _, size := range benchmarkSizes {
+		// The parents share their ancestry but have grown apart
+		base := createRandomOrganism(size.nInputs, size.nOutputs, size.splits, size.connections)
+		x := base.clone()
+		y := base.clone()
+		for i := 0; i < size.splits/5+1; i++ {
+			x.addConnection()
+			y.addConnection()
+		}
+
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				mate(x, y)
+			}
+		})
+	}
+}
+
+func BenchmarkMutate(b *testing.B) {
+	withSeed(b, 1)
+
+	for _, size := range benchmarkSizes {
+		org := createRandomOrganism(size.nInputs, size.nOutputs, size.splits, size.connections)
+
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// Mutate a fresh copy every time so that the network
+				// doesn't keep growing
+				b.StopTimer()
+				clone := org.clone()
+				b.StartTimer()
+
+				clone.mutate()
+			}
+		})
+	}
+}
+
+// The memory a large population holds once it has been evaluated. The
+// state of the neurons is released after every evaluation, the baseline
+// keeps it with every organism the way the genome used to.
+func BenchmarkPopulationMemory(b *testing.B) {
+	withSeed(b, 1)
+	org := createRandomOrganism(32, 8, 200, 200)
+	input := make([]float64, len(org.sensors))
+	eval := func(org *organism) float64 {
+		return org.process(input)[0]
+	}
+
+	held := func(b *testing.B, keepState bool) {
+		b.ReportAllocs()
+		var bytes float64
+		for i := 0; i < b.N; i++ {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			population := make([]*organism, 100)
+			activations := make([]*Activation, 0, len(population))
+			for j := range population {
+				population[j] = org.clone()
+				if keepState {
+					a := population[j].NewActivation()
+					a.Process(input)
+					activations = append(activations, a)
+				} else {
+					Evaluate(population[j], eval)
+				}
+			}
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			bytes = float64(after.HeapAlloc-before.HeapAlloc) / float64(len(population))
+			runtime.KeepAlive(population)
+			runtime.KeepAlive(activations)
+		}
+		b.ReportMetric(bytes, "B/organism")
+	}
+
+	b.Run("baseline", func(b *testing.B) { held(b, true) })
+	b.Run("released", func(b *testing.B) { held(b, false) })
+}
+
+func TestCorrelatedWeightMutation(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseWeightMutProb = 1
+		c.OrganismConfig.CorrelatedWeightMutation = 0.5
+	})
+
+	// Three synapses into the output
+	org := newOrganism(3, 1)
+	weights := []float64{0.5, -2, 1}
+	incoming := make([]*synapse, len(org.sensors))
+	for i, sensor := range org.sensors {
+		incoming[i] = org.synapses[org.connections[sensor][0]]
+		incoming[i].weight = weights[i]
+	}
+
+	for round := 0; round < 10; round++ {
+		before := make([]float64, len(incoming))
+		for i, s := range incoming {
+			before[i] = s.weight
+		}
+
+		org.mutate()
+
+		// Every weight is scaled by the same factor
+		scale := incoming[0].weight / before[0]
+		require.NotEqual(t, 1.0, scale, "")
+		for i, s := range incoming {
+			require.InDelta(t, scale*before[i], s.weight, 1e-9, "")
+		}
+	}
+
+	// Scaling never takes a weight beyond the bound. With RandFloat64 at
+	// 0.999 the normal draw is about 3.7, a scale of about 2.9.
+	f := RandFloat64
+	RandFloat64 = func() float64 { return 0.999 }
+	defer func() { RandFloat64 = f }()
+
+	bound := config.OrganismConfig.SynapseWeightBound
+	for i, s := range incoming {
+		s.weight = bound / 2 * float64(1-2*(i%2))
+	}
+	org.mutateIncomingWeights(config.OrganismConfig)
+	for i, s := range incoming {
+		require.Equal(t, bound*float64(1-2*(i%2)), s.weight, "")
+	}
+}
+
+func TestMostInfluentialSynapse(t *testing.T) {
+	// Two paths to the output, one far stronger than the other
+	org := newOrganism(2, 1)
+	strong := org.synapses[org.connections[org.sensors[0]][0]]
+	weak := org.synapses[org.connections[org.sensors[1]][0]]
+	strong.weight = 3
+	weak.weight = 0.1
+	org.splitSynapse(strong.id)
+
+	inputs := [][]float64{{1, 1}, {0.5, -1}, {-1, 0.5}}
+	output := func(out []float64) float64 { return out[0] }
+
+	influential := org.MostInfluentialSynapse(inputs, output)
+	require.NotEqual(t, weak.id, influential, "")
+	require.Equal(t, org.neurons[org.sensors[0]].id, org.synapses[influential].in, "")
+
+	// The weights are restored
+	require.Equal(t, 0.1, weak.weight, "")
+
+	weak.weight = 10
+	require.Equal(t, weak.id, org.MostInfluentialSynapse(inputs, output), "")
+
+	// Nothing to find without enabled synapses
+	for _, s := range org.synapses {
+		s.enabled = false
+	}
+	require.Equal(t, synapseID(0), org.MostInfluentialSynapse(inputs, output), "")
+}
+
+// A feedforward network, splitting synapses never closes a cycle
+func createFeedforwardOrganism(nInputs, nOutputs, splits int) *organism {
+	return createRandomOrganism(nInputs, nOutputs, splits, 0)
+}
+
+func TestPropagateCSR(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) { c.OrganismConfig.actFunc = Sigmoid })
+
+	for checked := 0; checked < 10; {
+		org := createFeedforwardOrganism(3, 2, 20)
+
+		// Added connections may skip layers or close cycles
+		for j := 0; j < 5; j++ {
+			org.addConnection()
+		}
+		if _, recurrent := org.topologicalOrder(); len(recurrent) > 0 {
+			continue
+		}
+		checked++
+
+		reference := org.clone()
+		for _, input := range [][]float64{{1, 0, 0}, {0.5, -1, 2}, {0, 0, 0}} {
+			org.activation().feed(input)
+			org.activation().propagateCSR(time.Time{})
+			reference.processFeedforward(input)
+
+			for id := range org.neurons {
+				require.Equal(t, reference.state(id).value, org.state(id).value, "")
+			}
+		}
+	}
+}
+
+func TestProcessSkipConnection(t *testing.T) {
+	// sensor -> output and sensor -> hidden -> output
+	org := newOrganism(1, 1)
+	skip := org.connections[org.sensors[0]][0]
+	org.splitSynapse(skip)
+	org.toggleEnabled(skip)
+	org.synapses[skip].weight = 2
+
+	// The output waits for the signal through the hidden neuron, nothing
+	// is left for the next input
+	require.Equal(t, []float64{3}, org.process([]float64{1}), "")
+	require.Equal(t, []float64{0}, org.process([]float64{0}), "")
+
+	// The same when giving up after a timeout
+	out, finished := org.ProcessWithTimeout([]float64{1}, time.Minute)
+	require.True(t, finished, "")
+	require.Equal(t, []float64{3}, out, "")
+	out, finished = org.ProcessWithTimeout([]float64{0}, time.Minute)
+	require.True(t, finished, "")
+	require.Equal(t, []float64{0}, out, "")
+}
+
+func TestActivation(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) { c.OrganismConfig.actFunc = Sigmoid })
+
+	org := createSimpleRecurrent()
+	inputs := [][]float64{{1}, {0.5}, {-1}, {0}}
+	expected := org.clone().ProcessBatch(inputs)
+
+	// Activations of the same genome keep their states apart and can run
+	// concurrently
+	var wg sync.WaitGroup
+	outputs := make([][][]float64, 4)
+	errs := make([]error, len(outputs))
+	for i := range outputs {
+		a := org.NewActivation()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, input := range inputs {
+				out, err := a.Process(input)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				outputs[i] = append(outputs[i], out)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, out := range outputs {
+		require.NoError(t, errs[i], "")
+		require.Equal(t, expected, out, "")
+	}
+	require.Nil(t, org.active, "")
+
+	// An evaluated organism is left without state
+	Evaluate(org, func(org *organism) float64 {
+		return org.process([]float64{1})[0]
+	})
+	require.Nil(t, org.active, "")
+}
+
+func TestCSRFollowsTopology(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.Equal(t, []float64{2}, org.process([]float64{1, 1}), "")
+	require.NotNil(t, org.csr, "")
+
+	// A structural change rebuilds the graph
+	org.splitSynapse(org.connections[org.sensors[0]][0])
+	require.Equal(t, []float64{2}, org.process([]float64{1, 1}), "")
+	require.Equal(t, len(org.neurons), len(org.csr.neurons), "")
+}
+
+func BenchmarkPropagate(b *testing.B) {
+	withSeed(b, 1)
+	withConfig(b, func(c *NeatConfig) { c.OrganismConfig.actFunc = Sigmoid })
+
+	// 200 neurons
+	org := createFeedforwardOrganism(10, 5, 185)
+	input := make([]float64, len(org.sensors))
+	for i := range input {
+		input[i] = RandFloat64()
+	}
+
+	b.Run("queue", func(b *testing.B) {
+		b.ReportAllocs()
+		a := org.NewActivation()
+		for i := 0; i < b.N; i++ {
+			a.feed(input)
+			a.propagateUntil(time.Time{})
+		}
+	})
+
+	b.Run("csr", func(b *testing.B) {
+		b.ReportAllocs()
+		a := org.NewActivation()
+		for i := 0; i < b.N; i++ {
+			a.feed(input)
+			a.propagateCSR(time.Time{})
+		}
+	})
+}
+
+func TestIsNonTrivial(t *testing.T) {
+	inputs := [][]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}}
+
+	org := newOrganism(2, 1)
+	require.True(t, org.IsNonTrivial(inputs), "")
+
+	// The same input over and over gives the same output
+	require.False(t, org.IsNonTrivial([][]float64{{1, 1}, {1, 1}}), "")
+	require.False(t, org.IsNonTrivial(nil), "")
+
+	zero := org.clone()
+	for _, s := range zero.synapses {
+		s.weight = 0
+	}
+	require.False(t, zero.IsNonTrivial(inputs), "")
+
+	for _, s := range org.synapses {
+		s.enabled = false
+	}
+	require.False(t, org.IsNonTrivial(inputs), "")
+}
+
+func TestRegulation(t *testing.T) {
+	org := newOrganism(1, 1)
+	org.splitSynapse(org.connections[org.sensors[0]][0])
+
+	var hidden neuronID
+	for id, n := range org.neurons {
+		if n.kind == hiddenNeuron {
+			hidden = id
+		}
+	}
+
+	// A silenced neuron outputs nothing and neither does the network
+	org.ApplyRegulation(map[neuronID]bool{hidden: true})
+	require.Equal(t, []float64{0}, org.process([]float64{1}), "")
+	require.Equal(t, 0.0, org.state(hidden).value, "")
+
+	org.ApplyRegulation(map[neuronID]bool{hidden: false})
+	require.Equal(t, []float64{1}, org.process([]float64{1}), "")
+	require.Equal(t, 1.0, org.state(hidden).value, "")
+
+	// Recurrent networks are silenced the same way
+	recurrent := createSimpleRecurrent()
+	for id, n := range recurrent.neurons {
+		if n.kind == hiddenNeuron {
+			recurrent.ApplyRegulation(map[neuronID]bool{id: true})
+		}
+	}
+	require.Equal(t, []float64{0}, recurrent.process([]float64{1}), "")
+
+	// The mutation toggles the only hidden neuron
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseAddMutProb = 0
+		c.OrganismConfig.RegulationMutProb = 1
+	})
+	org.mutate()
+	require.True(t, org.neurons[hidden].regulated, "")
+	require.True(t, loadOrganismOrFail(t, org).neurons[hidden].regulated, "")
+}
+
+// Save and load an organism
+func loadOrganismOrFail(t *testing.T, org *organism) *organism {
+	saved, err := saveOrganism(org)
+	require.NoError(t, err, "")
+	loaded, err := loadOrganism(saved, len(org.sensors), len(org.outputs))
+	require.NoError(t, err, "")
+	return loaded
+}
+
+func TestMaxNetworkSize(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.MaxNeurons = 4
+	})
+
+	// The first split reaches the cap, the ones after it do nothing
+	org := newOrganism(2, 1)
+	org.splitSynapse(org.connections[org.sensors[0]][0])
+	require.Equal(t, 4, len(org.neurons), "")
+
+	genes := len(org.genes)
+	org.splitSynapse(org.connections[org.sensors[1]][0])
+	require.Equal(t, 4, len(org.neurons), "")
+	require.Equal(t, genes, len(org.genes), "")
+
+	config.OrganismConfig.SynapseSplitMutProb = 1
+	for i := 0; i < 10; i++ {
+		org.mutate()
+	}
+	require.Equal(t, 4, len(org.neurons), "")
+
+	// Synapses are capped the same way
+	config.OrganismConfig.MaxSynapses = len(org.synapses)
+	require.False(t, org.addConnection(), "")
+	config.OrganismConfig.MaxSynapses = 0
+	require.True(t, org.addConnection(), "")
+}
+
+func TestWeightTable(t *testing.T) {
+	weights := func(org *organism) []float64 {
+		var w []float64
+		for _, g := range org.genes {
+			if s, ok := g.(*synapse); ok {
+				w = append(w, s.weight)
+			}
+		}
+		return w
+	}
+
+	table := func(seed int64, strategy string) []float64 {
+		table, err := InitializeWeightTable(4, seed, strategy, 2)
+		require.NoError(t, err, "")
+		return table
+	}
+
+	for _, strategy := range []string{WeightTableUniform, WeightTableNormal} {
+		require.Equal(t, table(42, strategy), table(42, strategy), "")
+		for _, w := range table(42, strategy) {
+			require.True(t, math.Abs(w) <= 2, "")
+		}
+
+		// The same table gives the same weights, a different seed doesn't
+		a := createFeedforwardOrganism(3, 2, 2)
+		b := a.clone()
+		c := a.clone()
+		a.ApplyWeightTable(table(42, strategy))
+		b.ApplyWeightTable(table(42, strategy))
+		c.ApplyWeightTable(table(7, strategy))
+		require.Equal(t, weights(a), weights(b), "")
+		require.NotEqual(t, weights(a), weights(c), "")
+	}
+
+	// The table is cycled through
+	org := newOrganism(3, 1)
+	org.ApplyWeightTable([]float64{1, 2})
+	require.Equal(t, []float64{1, 2, 1}, weights(org), "")
+
+	// An unknown strategy fails, even for an empty table
+	_, err := InitializeWeightTable(1, 1, "nope", 1)
+	require.Error(t, err, "")
+	require.Equal(t, "Unknown weight table strategy: nope", err.Error(), "")
+	_, err = InitializeWeightTable(0, 1, "nope", 1)
+	require.Error(t, err, "")
+}
+
+func TestWeightByInnovation(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.Equal(t, []float64{2}, org.process([]float64{1, 1}), "")
+
+	first := org.synapses[org.connections[org.sensors[0]][0]]
+	weight, ok := org.WeightByInnovation(first.innovation)
+	require.True(t, ok, "")
+	require.Equal(t, first.weight, weight, "")
+
+	// A clone shares the innovation numbers
+	clone := org.clone()
+	require.True(t, clone.SetWeightByInnovation(first.innovation, 3), "")
+	require.Equal(t, []float64{4}, clone.process([]float64{1, 1}), "")
+	require.Equal(t, []float64{2}, org.process([]float64{1, 1}), "")
+
+	// Neurons have innovation numbers too but no weight
+	sensor := org.neurons[org.sensors[0]]
+	_, ok = org.WeightByInnovation(sensor.innovation)
+	require.False(t, ok, "")
+	require.False(t, org.SetWeightByInnovation(sensor.innovation, 1), "")
+}
+
+func TestSumClamp(t *testing.T) {
+	// Positive feedback doubles the signal at every input
+	run := func() float64 {
+		org := createSimpleRecurrent()
+		for _, s := range org.synapses {
+			s.weight = 2
+		}
+
+		var largest float64
+		for i := 0; i < 100; i++ {
+			org.process([]float64{1})
+			for _, state := range org.active.states {
+				largest = math.Max(largest, math.Abs(state.value))
+			}
+		}
+		return largest
+	}
+	require.True(t, run() > 1e20, "")
+
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SumClamp = 10
+	})
+	require.Equal(t, 10.0, run(), "")
+}
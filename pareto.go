@@ -0,0 +1,142 @@
+package neat
+
+import (
+	"sort"
+)
+
+// The objectives of an organism in multi-objective optimization, every
+// objective is maximized
+type Objectives func(*organism) []float64
+
+// Does a dominate b, i.e. is a at least as good as b in every objective
+// and better in at least one
+func dominates(a, b []float64) bool {
+	better := false
+	for i := range a {
+		if a[i] < b[i] {
+			return false
+		}
+		if a[i] > b[i] {
+			better = true
+		}
+	}
+
+	return better
+}
+
+// Sort organisms into Pareto fronts. The first front holds the organisms
+// that no other organism dominates, the second front those dominated only
+// by organisms in the first front and so on. Organisms keep their relative
+// order within a front.
+func paretoFronts(organisms []*organism, objectives Objectives) [][]*organism {
+	values := make([][]float64, len(organisms))
+	for i, org := range organisms {
+		values[i] = objectives(org)
+	}
+
+	// The number of organisms dominating each organism and the organisms
+	// each organism dominates
+	dominatedBy := make([]int, len(organisms))
+	dominating := make([][]int, len(organisms))
+	for i := range organisms {
+		for j := range organisms {
+			if dominates(values[i], values[j]) {
+				dominating[i] = append(dominating[i], j)
+				dominatedBy[j]++
+			}
+		}
+	}
+
+	var current []int
+	for i, n := range dominatedBy {
+		if n == 0 {
+			current = append(current, i)
+		}
+	}
+
+	var fronts [][]*organism
+	for len(current) > 0 {
+		front := make([]*organism, len(current))
+		var next []int
+		for k, i := range current {
+			front[k] = organisms[i]
+			for _, j := range dominating[i] {
+				dominatedBy[j]--
+				if dominatedBy[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		fronts = append(fronts, front)
+
+		// Keep the original order within the front
+		sort.Ints(next)
+		current = next
+	}
+
+	return fronts
+}
+
+// An archive of the non-dominated organisms seen so far in
+// multi-objective optimization, a Pareto front that only moves forward
+type ParetoArchive struct {
+	objectives Objectives
+
+	// The archived organisms and their objectives
+	members []*organism
+	values  [][]float64
+}
+
+// Create an empty archive for the objectives
+func NewParetoArchive(objectives Objectives) *ParetoArchive {
+	return &ParetoArchive{objectives: objectives}
+}
+
+// Archive the organism unless an archived organism dominates it or has
+// the same objectives, and remove the archived organisms it dominates
+func (a *ParetoArchive) Add(org *organism) {
+	values := a.objectives(org)
+	for _, archived := range a.values {
+		if dominates(archived, values) || equalObjectives(archived, values) {
+			return
+		}
+	}
+
+	members, kept := a.members[:0], a.values[:0]
+	for i, archived := range a.values {
+		if !dominates(values, archived) {
+			members = append(members, a.members[i])
+			kept = append(kept, archived)
+		}
+	}
+
+	a.members = append(members, org)
+	a.values = append(kept, values)
+}
+
+// Does an archived organism dominate the organism
+func (a *ParetoArchive) IsDominated(org *organism) bool {
+	values := a.objectives(org)
+	for _, archived := range a.values {
+		if dominates(archived, values) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The archived organisms in the order they were archived
+func (a *ParetoArchive) Archive() []*organism {
+	return append([]*organism(nil), a.members...)
+}
+
+func equalObjectives(a, b []float64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
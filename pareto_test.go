@@ -0,0 +1,152 @@
+package neat
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParetoFronts(t *testing.T) {
+	organisms := createPopulation(1, 2, 3, 4)
+	for i, org := range organisms {
+		org.age = []int{0, 0, 2, 1}[i]
+	}
+
+	objectives := func(org *organism) []float64 {
+		return []float64{org.fitness, -float64(org.age)}
+	}
+	fronts := paretoFronts(organisms, objectives)
+
+	// The fourth organism is fitter and younger than the third
+	require.Equal(t, [][]*organism{
+		{organisms[1], organisms[3]},
+		{organisms[0], organisms[2]},
+	}, fronts, "")
+}
+
+// Is no archived organism dominated by another one
+func requireParetoFront(t *testing.T, archive []*organism, objectives Objectives) {
+	for _, a := range archive {
+		for _, b := range archive {
+			require.False(t, dominates(objectives(a), objectives(b)), "")
+		}
+	}
+}
+
+func TestParetoArchive(t *testing.T) {
+	withSeed(t, 1)
+
+	objectives := func(org *organism) []float64 {
+		return []float64{org.fitness, -float64(org.age)}
+	}
+	archive := NewParetoArchive(objectives)
+
+	organisms := createPopulation(1, 2, 3, 0)
+	for i, org := range organisms {
+		org.age = []int{0, 1, 0, 5}[i]
+	}
+
+	// Neither of the first two dominates the other
+	archive.Add(organisms[0])
+	archive.Add(organisms[1])
+	require.Equal(t, []*organism{organisms[0], organisms[1]}, archive.Archive(), "")
+
+	// The third is fitter and as young as both
+	archive.Add(organisms[2])
+	require.Equal(t, []*organism{organisms[2]}, archive.Archive(), "")
+
+	// The fourth is worse in both and isn't archived
+	require.True(t, archive.IsDominated(organisms[3]), "")
+	archive.Add(organisms[3])
+	require.Equal(t, []*organism{organisms[2]}, archive.Archive(), "")
+
+	// Whatever is added, the archive stays a Pareto front that covers
+	// everything that was added
+	var added []*organism
+	for i := 0; i < 200; i++ {
+		org := newOrganism(1, 1)
+		org.fitness = RandFloat64()
+		org.age = randIntn(20)
+		archive.Add(org)
+		added = append(added, org)
+
+		requireParetoFront(t, archive.Archive(), objectives)
+	}
+	for _, org := range added {
+		covered := false
+		for _, archived := range archive.Archive() {
+			covered = covered || archived == org || dominates(objectives(archived), objectives(org)) ||
+				equalObjectives(objectives(archived), objectives(org))
+		}
+		require.True(t, covered, "")
+	}
+}
+
+func TestMultiObjectiveStep(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0.1
+		c.OrganismConfig.SynapseAddMutProb = 0.1
+		c.OrganismConfig.SynapseWeightMutProb = 0.5
+		c.PopulationConfig.Size = 20
+	})
+
+	eval := func(org *organism) float64 {
+		return org.processFeedforward([]float64{1, 1})[0]
+	}
+
+	population := NewPopulation(2, 1, PopulationOptions{})
+	population.Step(eval)
+	require.Nil(t, population.ParetoArchive(), "")
+
+	config.PopulationConfig.MultiObjective = true
+	for i := 0; i < 5; i++ {
+		population.Step(eval)
+	}
+
+	// The archive holds the organisms that are fit for their size
+	archive := population.ParetoArchive().Archive()
+	objectives := population.ParetoArchive().objectives
+	require.True(t, len(archive) > 0, "")
+	requireParetoFront(t, archive, objectives)
+
+	best := math.Inf(-1)
+	for _, org := range archive {
+		best = math.Max(best, org.fitness)
+	}
+	require.True(t, best >= population.Champion().fitness, "")
+}
+
+func TestParetoArchiveAFPO(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseWeightMutProb = 0.5
+		c.PopulationConfig.Size = 10
+		c.PopulationConfig.DiversityMode = DiversityAFPO
+		c.PopulationConfig.MultiObjective = true
+	})
+
+	eval := func(org *organism) float64 {
+		return org.processFeedforward([]float64{1, 1})[0]
+	}
+
+	// The survivors grow older with every generation, the archived copies
+	// keep the age they were archived at
+	population := NewPopulation(2, 1, PopulationOptions{})
+	population.Objectives = func(org *organism) []float64 {
+		return []float64{org.fitness, -float64(org.age)}
+	}
+	for i := 0; i < 5; i++ {
+		population.Step(eval)
+	}
+
+	archive := population.ParetoArchive()
+	require.True(t, len(archive.members) > 0, "")
+	for i, org := range archive.members {
+		require.Equal(t, archive.values[i], population.Objectives(org), "")
+		for _, alive := range population.organisms {
+			require.False(t, org == alive, "")
+		}
+	}
+}
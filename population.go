@@ -0,0 +1,949 @@
+package neat
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+)
+
+// The signature of a fitness function, evaluates an organism and returns
+// its fitness
+type FitnessFunction func(*organism) float64
+
+// Options controlling how a population is run
+type PopulationOptions struct {
+	// Save the population every CheckpointEvery generations, zero disables
+	// checkpointing
+	CheckpointEvery int
+
+	// The file the checkpoints are saved to
+	CheckpointPath string
+
+	// The number of goroutines evaluating the organisms of a generation,
+	// the offspring in every DiversityMode, the fitness function must be
+	// safe for concurrent use if there is more than one. Zero or one
+	// evaluates the organisms one by one.
+	Workers int
+
+	// The fitness of an organism whose evaluation panics, e.g.
+	// math.Inf(-1) to rank it below every other organism. The panic is
+	// logged and the evolution carries on.
+	FailureFitness float64
+
+	// Where the population logs to, nil logs to the package Logger
+	Logger *log.Logger
+}
+
+// A population of organisms evolving under the global configuration
+type Population struct {
+	// The organisms of the current generation
+	organisms []*organism
+
+	// The number of sensors and outputs of each organism
+	nInputs  int
+	nOutputs int
+
+	// The number of generations evolved so far
+	generation int
+
+	// The species of the current generation
+	species []*Species
+
+	options PopulationOptions
+
+	// The statistics of every generation evolved so far
+	history []Stats
+
+	// The organisms of the current generation by id
+	registry *OrganismRegistry
+
+	// The size the population is resized to at the next generation, zero
+	// if it keeps its size
+	targetSize int
+
+	// The strategy used for selecting parents, defaults to tournament
+	// selection
+	Selection SelectionStrategy
+
+	// The objectives archived when MultiObjective is set, defaults to
+	// fitness and simplicity
+	Objectives Objectives
+
+	// The non-dominated organisms of all generations when MultiObjective
+	// is set
+	archive *ParetoArchive
+
+	// Called with the organisms of a generation before they are evaluated
+	// together, if set
+	beforeEvaluate func([]*organism)
+}
+
+// Fitness statistics of a generation
+type Stats struct {
+	Generation  int
+	MeanFitness float64
+	MaxFitness  float64
+	MinFitness  float64
+	NumSpecies  int
+}
+
+// Implemented by selection strategies that change from one generation to
+// the next, e.g. Boltzmann selection
+type annealer interface {
+	Anneal()
+}
+
+// Create a population of minimal organisms, or sparsely connected ones if
+// InitialConnectProb is set, with randomized weights. The size of the
+// population is taken from the global configuration.
+func NewPopulation(nInputs, nOutputs int, options PopulationOptions) *Population {
+	// All organisms descend from the same genome so that they share
+	// innovation numbers
+	prob := config.OrganismConfig.InitialConnectProb
+	base := newOrganism(nInputs, nOutputs)
+	if prob > 0 {
+		base = newFullyConnectedOrganism(nInputs, nOutputs)
+	}
+
+	organisms := make([]*organism, config.PopulationConfig.Size)
+	for i := range organisms {
+		org := base.clone()
+		if prob > 0 {
+			org = base.sparseClone(prob)
+		}
+		for _, g := range org.genes {
+			if s, ok := g.(*synapse); ok {
+				s.mutateWeight(config.OrganismConfig.SynapseWeightBound)
+			}
+		}
+		organisms[i] = org
+	}
+
+	p := newPopulationFrom(nInputs, nOutputs, organisms)
+	p.options = options
+	if options.Logger != nil {
+		Logger = options.Logger
+	}
+
+	return p
+}
+
+// Read a configuration file, make it the global configuration and create a
+// population of minimal organisms for it like NewPopulation, ready to
+// evolve
+func NewPopulationFromConfig(path string, nInputs, nOutputs int) (*Population, error) {
+	if nInputs < 1 || nOutputs < 1 {
+		return nil, errors.New("A population needs at least one input and one output")
+	}
+
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	SetNeatConfig(*cfg)
+
+	return NewPopulation(nInputs, nOutputs, PopulationOptions{}), nil
+}
+
+// Create popSize organisms from a seed organism, e.g. the champion of an
+// earlier run, mutated under the given configuration. The first organism is
+// an unchanged clone of the seed and every other organism is a clone with
+// one random mutation that doesn't add neurons. The global configuration
+// is left as it is, see SetNeatConfig.
+func SeedPopulation(seed *organism, popSize int, cfg NeatConfig) []*organism {
+	organisms := make([]*organism, popSize)
+	for i := range organisms {
+		organisms[i] = seed.clone()
+		if i > 0 {
+			organisms[i].mutateOnce(cfg.OrganismConfig)
+		}
+	}
+
+	return organisms
+}
+
+// Create a population from a set of existing organisms
+func newPopulationFrom(nInputs, nOutputs int, organisms []*organism) *Population {
+	p := &Population{
+		organisms: organisms,
+		nInputs:   nInputs,
+		nOutputs:  nOutputs,
+		registry:  newOrganismRegistry(),
+		Selection: NewTournamentSelection(2),
+	}
+	p.registry.reset(organisms)
+
+	return p
+}
+
+// The registry of the organisms of the current generation, kept up to
+// date as the population evolves
+func (p *Population) Registry() *OrganismRegistry {
+	return p.registry
+}
+
+// The number of generations evolved so far
+func (p *Population) Generation() int {
+	return p.generation
+}
+
+// The statistics of every generation evolved so far, oldest first
+func (p *Population) History() []Stats {
+	return p.history
+}
+
+// The statistics of the current generation
+func (p *Population) stats() Stats {
+	s := Stats{Generation: p.generation, NumSpecies: len(p.species)}
+	if len(p.organisms) == 0 {
+		return s
+	}
+
+	s.MaxFitness = math.Inf(-1)
+	s.MinFitness = math.Inf(1)
+	total := 0.0
+	for _, org := range p.organisms {
+		total += org.fitness
+		s.MaxFitness = math.Max(s.MaxFitness, org.fitness)
+		s.MinFitness = math.Min(s.MinFitness, org.fitness)
+	}
+	s.MeanFitness = total / float64(len(p.organisms))
+
+	return s
+}
+
+// The fittest organism of the current generation
+func (p *Population) Champion() *organism {
+	var champion *organism
+	for _, org := range p.organisms {
+		if champion == nil || fitter(org, champion) {
+			champion = org
+		}
+	}
+
+	return champion
+}
+
+// The number of organisms with each topology, keyed by topology hash.
+// Organisms that only differ in their weights share a topology.
+func (p *Population) TopologyHistogram() map[uint64]int {
+	histogram := make(map[uint64]int)
+	for _, org := range p.organisms {
+		histogram[org.topologyHash()]++
+	}
+
+	return histogram
+}
+
+// The number of distinct topologies in the population
+func (p *Population) DistinctTopologies() int {
+	return len(p.TopologyHistogram())
+}
+
+// Evolve the population one generation. The offspring are evaluated using
+// the fitness function so that the population is always evaluated after a
+// step.
+func (p *Population) Step(eval FitnessFunction) {
+	eval = trialEval(eval)
+	if config.PopulationConfig.FitnessTransform != "" {
+		raw := eval
+		eval = func(org *organism) float64 {
+			return PositiveFitness(raw(org))
+		}
+	}
+
+	// The initial population hasn't been evaluated yet
+	if p.generation == 0 {
+		p.evaluate(eval)
+	}
+
+	if p.targetSize > 0 {
+		p.resize(eval, p.targetSize)
+		p.targetSize = 0
+	}
+
+	// The champion is injected into the other species for one generation,
+	// the least fit organisms make room for it again below
+	size := len(p.organisms)
+	p.InjectChampion()
+
+	// Organisms that make it into the next generation grow older
+	for _, org := range p.organisms {
+		org.age++
+	}
+
+	switch config.PopulationConfig.DiversityMode {
+	case DiversityCrowding:
+		p.crowd(eval)
+	case DiversityAFPO:
+		p.afpo(eval)
+	default:
+		elites := p.reproduce()
+		p.evaluate(eval)
+		p.hillClimbOffspring(eval, p.organisms[elites:])
+	}
+	p.resize(eval, size)
+
+	if config.PopulationConfig.RandomInjectionCount > 0 {
+		p.injectRandom(eval, config.PopulationConfig.RandomInjectionCount)
+	}
+
+	if config.PopulationConfig.LocalSearch {
+		p.localSearch(eval)
+	}
+
+	if config.PopulationConfig.MultiObjective {
+		p.updateArchive()
+	}
+
+	p.species = speciate(p.species, p.organisms)
+
+	if a, ok := p.Selection.(annealer); ok {
+		a.Anneal()
+	}
+
+	p.registry.reset(p.organisms)
+
+	p.generation++
+	p.history = append(p.history, p.stats())
+
+	every := p.options.CheckpointEvery
+	if every > 0 && p.generation%every == 0 {
+		if err := p.Save(p.options.CheckpointPath); err != nil {
+			p.logf("Failed to save checkpoint: %v", err)
+		}
+	}
+}
+
+// The organism configuration with the mutation probabilities in effect for
+// the current generation, lowered by MutationDecayRate every
+// MutationDecayInterval generations. A probability already below
+// MinMutationRate is left as it is.
+func (p *Population) CurrentMutationRates() OrganismConfig {
+	c := config.OrganismConfig
+	if !mutationDecays() {
+		return c
+	}
+
+	factor := math.Pow(1-c.MutationDecayRate, float64(p.generation/c.MutationDecayInterval))
+	decay := func(prob float64) float64 {
+		return math.Max(math.Min(prob, c.MinMutationRate), prob*factor)
+	}
+
+	c.SynapseSplitMutProb = decay(c.SynapseSplitMutProb)
+	c.SynapseActivityMutProb = decay(c.SynapseActivityMutProb)
+	c.SynapseWeightMutProb = decay(c.SynapseWeightMutProb)
+	c.SynapseAddMutProb = decay(c.SynapseAddMutProb)
+	c.RegulationMutProb = decay(c.RegulationMutProb)
+
+	return c
+}
+
+// Are the mutation probabilities lowered over the generations
+func mutationDecays() bool {
+	c := config.OrganismConfig
+	return c.MutationDecayRate > 0 && c.MutationDecayInterval > 0
+}
+
+// The archive of copies of the non-dominated organisms of all generations,
+// nil unless MultiObjective is set
+func (p *Population) ParetoArchive() *ParetoArchive {
+	return p.archive
+}
+
+// Add copies of the organisms of the current generation to the archive,
+// so that the archived organisms don't change as their originals age
+func (p *Population) updateArchive() {
+	if p.archive == nil {
+		objectives := p.Objectives
+		if objectives == nil {
+			objectives = func(org *organism) []float64 {
+				return []float64{org.fitness, -float64(org.Complexity())}
+			}
+		}
+		p.archive = NewParetoArchive(objectives)
+	}
+
+	for _, org := range p.organisms {
+		clone := org.clone()
+		clone.generation = org.generation
+		clone.fitness = org.fitness
+		clone.age = org.age
+		p.archive.Add(clone)
+	}
+}
+
+// Options controlling when Evolve stops
+type EvolutionOptions struct {
+	// The number of generations the best fitness is averaged over, zero
+	// disables early stopping
+	EarlyStoppingWindow int
+
+	// Evolution stops when the moving average of the best fitness changes
+	// by less than this from one window to the next
+	EarlyStoppingThreshold float64
+}
+
+// Evolve the population for at most maxGenerations generations and return
+// the fittest organism. Evolution stops early when the best fitness has
+// plateaued, i.e. when the average best fitness of the last
+// EarlyStoppingWindow generations differs by less than
+// EarlyStoppingThreshold from the average of the window before it. An
+// empty population has no fittest organism, nil is returned.
+func (p *Population) Evolve(eval FitnessFunction, maxGenerations int, options EvolutionOptions) *organism {
+	window := options.EarlyStoppingWindow
+
+	// The best fitness of each generation
+	var best []float64
+	average := func(fitness []float64) float64 {
+		sum := 0.0
+		for _, f := range fitness {
+			sum += f
+		}
+		return sum / float64(len(fitness))
+	}
+
+	for i := 0; i < maxGenerations; i++ {
+		p.Step(eval)
+
+		champion := p.Champion()
+		if champion == nil {
+			return nil
+		}
+		best = append(best, champion.fitness)
+
+		if n := len(best); window > 0 && n >= 2*window {
+			current := average(best[n-window:])
+			previous := average(best[n-2*window : n-window])
+			if math.Abs(current-previous) < options.EarlyStoppingThreshold {
+				break
+			}
+		}
+	}
+
+	return p.Champion()
+}
+
+// Add a copy of the champion to every species whose representative it
+// isn't compatible with, so that no species has to start from scratch.
+// Step injects the champion at the start of every generation. The copies
+// keep the champion's fitness but start at age zero.
+func (p *Population) InjectChampion() {
+	champion := p.Champion()
+	if champion == nil {
+		return
+	}
+
+	for _, s := range p.species {
+		if compatibilityDistance(s.representative(), champion) <= config.SpeciesConfig.CompatibilityThreshold {
+			continue
+		}
+
+		clone := champion.clone()
+		clone.generation = champion.generation
+		clone.fitness = champion.fitness
+		clone.species = s.id
+
+		p.organisms = append(p.organisms, clone)
+		p.registry.Register(clone)
+		s.population = append(s.population, clone)
+	}
+}
+
+// Evaluate the fitness of all organisms
+func (p *Population) evaluate(eval FitnessFunction) {
+	p.evaluateAll(p.organisms, eval)
+}
+
+// Evaluate the fitness of a batch of organisms, e.g. the offspring of a
+// generation, with the workers of the population
+func (p *Population) evaluateAll(organisms []*organism, eval FitnessFunction) {
+	if p.beforeEvaluate != nil {
+		p.beforeEvaluate(organisms)
+	}
+
+	if p.options.Workers <= 1 {
+		for _, org := range organisms {
+			org.fitness = p.fitnessOf(org, eval)
+		}
+		return
+	}
+
+	// Every organism is evaluated by exactly one worker
+	queue := make(chan *organism)
+	var wg sync.WaitGroup
+	for i := 0; i < p.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for org := range queue {
+				org.fitness = p.fitnessOf(org, eval)
+			}
+		}()
+	}
+
+	for _, org := range organisms {
+		queue <- org
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// Evaluate an organism, an evaluation that panics gives the failure fitness.
+// The state of the neurons is released afterwards.
+func (p *Population) fitnessOf(org *organism, eval FitnessFunction) (fitness float64) {
+	defer org.resetStates()
+	defer func() {
+		if r := recover(); r != nil {
+			p.logf("Evaluation of organism %d panicked: %v", org.id, r)
+			fitness = p.options.FailureFitness
+		}
+	}()
+
+	return eval(org)
+}
+
+// Where the messages that don't belong to a population are logged, e.g.
+// the warnings about deprecated settings when reading a configuration. Nil
+// logs to the standard logger. Creating a population with a Logger in its
+// options makes it the package logger too.
+var Logger *log.Logger
+
+// Log through the package logger
+func logf(format string, args ...interface{}) {
+	if Logger != nil {
+		Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Log through the logger of the population options, the package logger if
+// there is none
+func (p *Population) logf(format string, args ...interface{}) {
+	if p.options.Logger != nil {
+		p.options.Logger.Printf(format, args...)
+	} else {
+		logf(format, args...)
+	}
+}
+
+// Evaluate a single organism outside of a population, e.g. to score a
+// genome loaded from a checkpoint. The organism starts out at rest, so that
+// earlier inputs to a recurrent network don't affect the result, and its
+// fitness is stored and returned. The organism is left at rest.
+func Evaluate(org *organism, eval FitnessFunction) float64 {
+	org.resetStates()
+	org.fitness = eval(org)
+	org.resetStates()
+
+	return org.fitness
+}
+
+// The fitness function evaluating every organism FitnessEvalTrials times
+// and combining the trials as set by FitnessTrialAggregation, or the
+// fitness function itself for a single trial
+func trialEval(eval FitnessFunction) FitnessFunction {
+	n := config.PopulationConfig.FitnessEvalTrials
+	if n <= 1 {
+		return eval
+	}
+
+	if config.PopulationConfig.FitnessTrialAggregation == TrialsMin {
+		return func(org *organism) float64 {
+			samples, _ := runTrials(org, eval, n)
+
+			lowest := math.Inf(1)
+			for _, sample := range samples {
+				lowest = math.Min(lowest, sample)
+			}
+			return lowest
+		}
+	}
+
+	return func(org *organism) float64 {
+		return StochasticEval(org, eval, n)
+	}
+}
+
+// Evaluate an organism in a noisy environment nTrials times, starting out
+// at rest every time, and return the mean fitness, the standard deviation
+// of the trials is kept and returned by StdDev. At least one trial is run.
+func StochasticEval(org *organism, eval func(*organism) float64, nTrials int) float64 {
+	_, mean := runTrials(org, eval, nTrials)
+	return mean
+}
+
+// Evaluate an organism nTrials times, at least once, and return the
+// fitness of every trial and their mean. The organism starts out at rest
+// in every trial so that the trials are independent, and the standard
+// deviation of the trials is kept for StdDev.
+func runTrials(org *organism, eval func(*organism) float64, nTrials int) ([]float64, float64) {
+	samples := make([]float64, max(1, nTrials))
+	mean := 0.0
+	for i := range samples {
+		org.resetStates()
+		samples[i] = eval(org)
+		mean += samples[i]
+	}
+	mean /= float64(len(samples))
+	org.resetStates()
+
+	variance := 0.0
+	for _, sample := range samples {
+		variance += (sample - mean) * (sample - mean)
+	}
+	org.fitnessStdDev = math.Sqrt(variance / float64(len(samples)))
+
+	return samples, mean
+}
+
+// The standard deviation of the fitness over the trials of the last
+// StochasticEval, zero if the organism hasn't been evaluated that way
+func (org *organism) StdDev() float64 {
+	return org.fitnessStdDev
+}
+
+// The strategy for selecting parents. When no organism has any fitness,
+// e.g. before the fitness function tells the organisms apart, every
+// organism is an equally good parent and they are selected uniformly.
+func (p *Population) selection() SelectionStrategy {
+	for _, org := range p.organisms {
+		if org.fitness != 0 {
+			return p.Selection
+		}
+	}
+
+	return uniformSelection{}
+}
+
+// Create an offspring of two parents mutated with the mutation
+// probabilities of the given configuration
+func breed(a, b *organism, c OrganismConfig) *organism {
+	offspring := mate(a, b)
+	offspring.mutateWith(c)
+
+	return offspring
+}
+
+// Replace the population with the offspring of selected parents, the
+// fittest organism, or the PopulationElitism fittest organisms, survive
+// unchanged. Copies of an elite, e.g. an injected champion, don't take up
+// another elite's place. The survivors come first, returns how many there
+// are.
+func (p *Population) reproduce() int {
+	if len(p.organisms) == 0 {
+		return 0
+	}
+
+	sorted := make([]*organism, len(p.organisms))
+	copy(sorted, p.organisms)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return fitter(sorted[i], sorted[j])
+	})
+
+	// The elites, the champion at least, carry over unchanged
+	n := max(1, config.PopulationConfig.PopulationElitism)
+	var elites []*organism
+	for _, org := range sorted {
+		if len(elites) == n {
+			break
+		}
+
+		duplicate := false
+		for _, elite := range elites {
+			duplicate = duplicate ||
+				len(elite.genes) == len(org.genes) && GenomeDiff(elite, org).Empty()
+		}
+		if !duplicate {
+			elites = append(elites, org)
+		}
+	}
+
+	next := make([]*organism, 0, len(p.organisms))
+	for _, elite := range elites {
+		clone := elite.clone()
+		clone.generation = elite.generation
+		clone.age = elite.age
+		next = append(next, clone)
+	}
+
+	rates := p.CurrentMutationRates()
+	selection := p.selection()
+	for len(next) < len(p.organisms) {
+		a := selection.Select(p.organisms)
+		b := selection.Select(p.organisms)
+
+		next = append(next, breed(a, b, rates))
+	}
+
+	p.organisms = next
+
+	return len(elites)
+}
+
+// Tune the weights of the evaluated offspring with PostMatingHillClimbSteps
+// steps of hill-climbing each, if set
+func (p *Population) hillClimbOffspring(eval FitnessFunction, offspring []*organism) {
+	steps := config.OrganismConfig.PostMatingHillClimbSteps
+	if steps <= 0 {
+		return
+	}
+
+	safe := func(org *organism) float64 {
+		return p.fitnessOf(org, eval)
+	}
+	for _, org := range offspring {
+		HillClimbWeights(org, safe, steps)
+	}
+}
+
+// Deterministic crowding. The population is paired up at random and each
+// pair produces two offspring. Each offspring competes against the parent
+// it is most similar to and replaces it if it is fitter. Since offspring
+// only replace similar organisms distinct niches are preserved.
+func (p *Population) crowd(eval FitnessFunction) {
+	// Shuffle the population to pair up random parents
+	for i := len(p.organisms) - 1; i > 0; i-- {
+		j := randIntn(i + 1)
+		p.organisms[i], p.organisms[j] = p.organisms[j], p.organisms[i]
+	}
+
+	// The offspring of all pairs are evaluated together, the offspring of
+	// the parents at i and i+1 are at the same indices
+	rates := p.CurrentMutationRates()
+	offspring := make([]*organism, len(p.organisms)/2*2)
+	for i := 0; i+1 < len(p.organisms); i += 2 {
+		a, b := p.organisms[i], p.organisms[i+1]
+		offspring[i] = breed(a, b, rates)
+		offspring[i+1] = breed(b, a, rates)
+	}
+	p.evaluateAll(offspring, eval)
+	p.hillClimbOffspring(eval, offspring)
+
+	for i := 0; i+1 < len(p.organisms); i += 2 {
+		a, b := p.organisms[i], p.organisms[i+1]
+		aChild, bChild := offspring[i], offspring[i+1]
+
+		// Match the offspring with the parents so that the total distance
+		// between the competitors is minimized
+		if compatibilityDistance(a, aChild)+compatibilityDistance(b, bChild) >
+			compatibilityDistance(a, bChild)+compatibilityDistance(b, aChild) {
+			aChild, bChild = bChild, aChild
+		}
+
+		if aChild.fitness > a.fitness {
+			p.organisms[i] = aChild
+		}
+		if bChild.fitness > b.fitness {
+			p.organisms[i+1] = bChild
+		}
+	}
+}
+
+// Age-fitness Pareto optimization. Offspring inherit the age of their
+// oldest parent and a new random organism of age zero is added every
+// generation. The survivors are picked front by front from the Pareto
+// fronts of fitness and youth among parents and offspring. The last front
+// that fits is thinned out from both ends so that neither the fittest nor
+// the youngest organisms are crowded out.
+func (p *Population) afpo(eval FitnessFunction) {
+	size := len(p.organisms)
+	if size == 0 {
+		return
+	}
+
+	candidates := make([]*organism, 0, 2*size+1)
+	candidates = append(candidates, p.organisms...)
+
+	rates := p.CurrentMutationRates()
+	selection := p.selection()
+	offspring := make([]*organism, size)
+	for i := range offspring {
+		a := selection.Select(p.organisms)
+		b := selection.Select(p.organisms)
+
+		offspring[i] = breed(a, b, rates)
+		offspring[i].age = max(a.age, b.age)
+	}
+
+	// The newcomer is evaluated with the offspring but isn't climbed
+	young := p.randomOrganism()
+	p.evaluateAll(append(offspring, young), eval)
+	p.hillClimbOffspring(eval, offspring)
+	candidates = append(candidates, offspring...)
+	candidates = append(candidates, young)
+
+	objectives := func(org *organism) []float64 {
+		return []float64{org.fitness, -float64(org.age)}
+	}
+
+	survivors := make([]*organism, 0, size)
+	for _, front := range paretoFronts(candidates, objectives) {
+		if len(survivors)+len(front) > size {
+			front = extremes(front, size-len(survivors))
+		}
+
+		survivors = append(survivors, front...)
+		if len(survivors) == size {
+			break
+		}
+	}
+
+	p.organisms = survivors
+}
+
+// Pick n organisms from a Pareto front of fitness and youth by alternately
+// taking the fittest and the youngest of the remaining organisms
+func extremes(front []*organism, n int) []*organism {
+	byFitness := make([]*organism, len(front))
+	copy(byFitness, front)
+	sort.SliceStable(byFitness, func(i, j int) bool {
+		return fitter(byFitness[i], byFitness[j])
+	})
+
+	byAge := make([]*organism, len(front))
+	copy(byAge, front)
+	sort.SliceStable(byAge, func(i, j int) bool {
+		return byAge[i].age < byAge[j].age
+	})
+
+	picked := make(map[*organism]bool)
+	result := make([]*organism, 0, n)
+	for i := 0; len(result) < n; i++ {
+		sorted := byFitness
+		if i%2 == 1 {
+			sorted = byAge
+		}
+
+		for _, org := range sorted {
+			if !picked[org] {
+				picked[org] = true
+				result = append(result, org)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// A minimal organism with random weights that shares its sensor and output
+// genes with the population so that it can mate with it. A synapse that
+// already connects the same neurons in the population is reused with its
+// innovation number, so that it lines up with the synapses of the others.
+func (p *Population) randomOrganism() *organism {
+	template := p.organisms[0]
+
+	org := _newOrganism(p.nInputs, p.nOutputs)
+	for _, g := range template.genes {
+		if n, ok := g.(*neuron); ok && n.kind != hiddenNeuron {
+			org.addNeuron(n.clone())
+		}
+	}
+
+	existing := make(map[[2]neuronID]*synapse)
+	for _, member := range p.organisms {
+		for _, g := range member.genes {
+			if s, ok := g.(*synapse); ok && existing[[2]neuronID{s.in, s.out}] == nil {
+				existing[[2]neuronID{s.in, s.out}] = s
+			}
+		}
+	}
+
+	for i := 0; i < max(p.nInputs, p.nOutputs); i++ {
+		in := org.neurons[org.sensors[i%p.nInputs]]
+		out := org.neurons[org.outputs[i%p.nOutputs]]
+
+		var synapse *synapse
+		if s, ok := existing[[2]neuronID{in.id, out.id}]; ok {
+			synapse = s.clone()
+			synapse.enabled = true
+			synapse.locked = false
+		} else {
+			synapse = newSynapse(in, out)
+		}
+		synapse.mutateWeight(config.OrganismConfig.SynapseWeightBound)
+		org.addSynapse(synapse)
+	}
+	org.SortGenes()
+
+	return org
+}
+
+// Replace the n least fit organisms, never the champion, with fresh
+// mutated minimal organisms
+func (p *Population) injectRandom(eval FitnessFunction, n int) {
+	n = min(n, len(p.organisms)-1)
+	if n <= 0 {
+		return
+	}
+
+	sort.SliceStable(p.organisms, func(i, j int) bool {
+		return fitter(p.organisms[i], p.organisms[j])
+	})
+
+	rates := p.CurrentMutationRates()
+	for i := len(p.organisms) - n; i < len(p.organisms); i++ {
+		org := p.randomOrganism()
+		org.mutateWith(rates)
+		org.fitness = p.fitnessOf(org, eval)
+		p.organisms[i] = org
+	}
+}
+
+// The species of the current generation
+func (p *Population) Species() []*Species {
+	return p.species
+}
+
+// The number of organisms in the current generation
+func (p *Population) Size() int {
+	return len(p.organisms)
+}
+
+// Grow or shrink the population to n organisms, at least one, from the
+// next generation on
+func (p *Population) Resize(n int) {
+	p.targetSize = max(1, n)
+}
+
+// Drop the least fit organisms or add mutated clones of selected organisms
+// until there are n organisms
+func (p *Population) resize(eval FitnessFunction, n int) {
+	if n < len(p.organisms) {
+		sort.SliceStable(p.organisms, func(i, j int) bool {
+			return fitter(p.organisms[i], p.organisms[j])
+		})
+		p.organisms = p.organisms[:n]
+	}
+
+	rates := p.CurrentMutationRates()
+	selection := p.selection()
+	for len(p.organisms) < n {
+		org := selection.Select(p.organisms).clone()
+		org.mutateWith(rates)
+		org.fitness = p.fitnessOf(org, eval)
+		p.organisms = append(p.organisms, org)
+	}
+}
+
+// Tune the weights of the fittest organisms by hill-climbing
+func (p *Population) localSearch(eval FitnessFunction) {
+	fittest := make([]*organism, len(p.organisms))
+	copy(fittest, p.organisms)
+	sort.SliceStable(fittest, func(i, j int) bool {
+		return fitter(fittest[i], fittest[j])
+	})
+
+	safe := func(org *organism) float64 {
+		return p.fitnessOf(org, eval)
+	}
+	n := min(config.PopulationConfig.LocalSearchOrganisms, len(fittest))
+	for _, org := range fittest[:n] {
+		org.tuneWeights(safe, config.PopulationConfig.LocalSearchSteps)
+	}
+}
@@ -0,0 +1,1280 @@
+package neat
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Run a test under a modified configuration
+func withConfig(t testing.TB, modify func(*NeatConfig)) {
+	c := testConfig
+	modify(&c)
+	SetNeatConfig(c)
+	t.Cleanup(func() { SetNeatConfig(testConfig) })
+}
+
+// Seed the random function for the duration of a test
+func withSeed(t testing.TB, seed int64) {
+	f := RandFloat64
+	RandFloat64 = rand.New(rand.NewSource(seed)).Float64
+	t.Cleanup(func() { RandFloat64 = f })
+}
+
+// Does the organism have a gene with the innovation number
+func hasInnovation(org *organism, innovation uint64) bool {
+	for _, g := range org.genes {
+		if g.getInnovation() == innovation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The number of distinct gene sets in the population
+func countTopologies(organisms []*organism) int {
+	topologies := make(map[string]bool)
+	for _, org := range organisms {
+		innovations := make([]uint64, len(org.genes))
+		for i, g := range org.genes {
+			innovations[i] = g.getInnovation()
+		}
+		topologies[fmt.Sprint(innovations)] = true
+	}
+
+	return len(topologies)
+}
+
+// Create a population with two niches, a and b, where a is slightly fitter
+// than b and mixing the two is a lot worse than either. Returns the
+// population and the fitness function.
+func createTwoNichePopulation(size int) (*Population, FitnessFunction) {
+	base := newOrganism(1, 1)
+	id := base.genes[2].(*synapse).id
+
+	a := base.clone()
+	a.splitSynapse(id)
+	aInnovation := a.genes[3].getInnovation()
+
+	b := base.clone()
+	b.splitSynapse(id)
+	bInnovation := b.genes[3].getInnovation()
+
+	organisms := make([]*organism, size)
+	for i := range organisms {
+		if i%2 == 0 {
+			organisms[i] = a.clone()
+		} else {
+			organisms[i] = b.clone()
+		}
+	}
+
+	eval := func(org *organism) float64 {
+		hasA := hasInnovation(org, aInnovation)
+		hasB := hasInnovation(org, bInnovation)
+
+		switch {
+		case hasA && !hasB:
+			return 1.0
+		case hasB && !hasA:
+			return 0.9
+		default:
+			return 0.5
+		}
+	}
+
+	return newPopulationFrom(1, 1, organisms), eval
+}
+
+func TestCrowdingPreservesNiches(t *testing.T) {
+	withSeed(t, 1)
+
+	noMutation := func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseWeightMutProb = 0
+	}
+
+	generations := 50
+
+	// With plain elitism the slightly fitter niche takes over
+	withConfig(t, func(c *NeatConfig) {
+		noMutation(c)
+		c.PopulationConfig.DiversityMode = DiversityElitism
+	})
+
+	population, eval := createTwoNichePopulation(20)
+	require.Equal(t, 2, countTopologies(population.organisms), "")
+	for i := 0; i < generations; i++ {
+		population.Step(eval)
+	}
+	require.Equal(t, 1, countTopologies(population.organisms), "")
+	require.Equal(t, 1.0, population.Champion().fitness, "")
+
+	// Crowding keeps both niches alive
+	withConfig(t, func(c *NeatConfig) {
+		noMutation(c)
+		c.PopulationConfig.DiversityMode = DiversityCrowding
+	})
+
+	population, eval = createTwoNichePopulation(20)
+	for i := 0; i < generations; i++ {
+		population.Step(eval)
+	}
+	require.Equal(t, 2, countTopologies(population.organisms), "")
+	require.Equal(t, 20, len(population.organisms), "")
+	require.Equal(t, generations, population.Generation(), "")
+}
+
+// Fitness is highest when the single output is 0.7 for an input of 1
+func weightSensitiveEval(org *organism) float64 {
+	return -math.Abs(org.process([]float64{1})[0] - 0.7)
+}
+
+func TestTuneWeights(t *testing.T) {
+	withSeed(t, 1)
+
+	org := newOrganism(1, 1)
+	org.fitness = weightSensitiveEval(org)
+	untuned := org.clone()
+	untuned.fitness = weightSensitiveEval(untuned)
+
+	org.tuneWeights(weightSensitiveEval, 10)
+
+	require.True(t, org.fitness > untuned.fitness, "")
+	require.Equal(t, org.fitness, weightSensitiveEval(org), "")
+
+	// Weights are kept within the bound however much a larger weight would
+	// improve the fitness
+	bound := config.OrganismConfig.SynapseWeightBound
+	for _, s := range org.synapses {
+		s.weight = bound
+	}
+	f := RandFloat64
+	RandFloat64 = func() float64 { return 0.99 }
+	t.Cleanup(func() { RandFloat64 = f })
+	larger := func(org *organism) float64 {
+		sum := 0.0
+		for _, s := range org.synapses {
+			sum += s.weight
+		}
+		return sum
+	}
+	org.fitness = larger(org)
+	org.tuneWeights(larger, 10)
+	for _, s := range org.synapses {
+		require.Equal(t, bound, s.weight, "")
+	}
+}
+
+func TestHillClimbWeights(t *testing.T) {
+	withSeed(t, 1)
+
+	org := newOrganism(2, 1)
+	eval := func(org *organism) float64 {
+		return -math.Abs(org.process([]float64{1, 1})[0] - 0.7)
+	}
+
+	// The fitness never gets worse from one step to the next, and every
+	// step is a single evaluation starting from the current fitness
+	org.fitness = eval(org)
+	calls := 0
+	counted := func(org *organism) float64 {
+		calls++
+		return eval(org)
+	}
+	previous := org.fitness
+	for i := 0; i < 50; i++ {
+		fitness := HillClimbWeights(org, counted, 1)
+		require.True(t, fitness >= previous, "")
+		require.Equal(t, fitness, eval(org), "")
+		previous = fitness
+	}
+	require.Equal(t, 50, calls, "")
+	require.True(t, previous > -0.1, "")
+
+	// Every offspring is climbed after it is evaluated, whatever the
+	// diversity mode
+	climbed := func(mode string) int {
+		withConfig(t, func(c *NeatConfig) {
+			c.PopulationConfig.Size = 10
+			c.PopulationConfig.DiversityMode = mode
+			c.OrganismConfig.PostMatingHillClimbSteps = 5
+
+			// A single species, so that no champion is injected
+			c.SpeciesConfig.CompatibilityThreshold = 1000
+		})
+
+		population := NewPopulation(2, 1, PopulationOptions{})
+		population.Step(eval)
+		calls = 0
+		population.Step(counted)
+
+		return calls
+	}
+
+	// An evaluation of every organism, then five steps for every
+	// offspring but the champion
+	require.Equal(t, 10+9*5, climbed(""), "")
+
+	// The same for both offspring of each of the five pairs
+	require.Equal(t, 5*2*6, climbed(DiversityCrowding), "")
+
+	// The same for the ten offspring, and an evaluation of the newcomer
+	require.Equal(t, 10*6+1, climbed(DiversityAFPO), "")
+}
+
+func TestLocalSearch(t *testing.T) {
+	withSeed(t, 1)
+
+	step := func(localSearch bool) float64 {
+		withConfig(t, func(c *NeatConfig) {
+			c.OrganismConfig.SynapseSplitMutProb = 0
+			c.OrganismConfig.SynapseActivityMutProb = 0
+			c.OrganismConfig.SynapseWeightMutProb = 0
+			c.PopulationConfig.LocalSearch = localSearch
+			c.PopulationConfig.LocalSearchSteps = 5
+			c.PopulationConfig.LocalSearchOrganisms = 1
+		})
+
+		org := newOrganism(1, 1)
+		population := newPopulationFrom(1, 1,
+			[]*organism{org, org.clone(), org.clone(), org.clone()})
+		population.Step(weightSensitiveEval)
+
+		return population.Champion().fitness
+	}
+
+	untuned := step(false)
+	tuned := step(true)
+
+	require.InDelta(t, -0.3, untuned, 1e-9, "")
+	require.True(t, tuned > untuned, "")
+
+	// An evaluation that panics while tuning gives the failure fitness
+	var logged bytes.Buffer
+	org := newOrganism(1, 1)
+	population := newPopulationFrom(1, 1, []*organism{org, org.clone()})
+	population.options = PopulationOptions{Logger: log.New(&logged, "", 0)}
+	population.Step(weightSensitiveEval)
+	require.NotPanics(t, func() {
+		population.Step(func(*organism) float64 { panic("environment failure") })
+	}, "")
+	require.True(t, strings.Contains(logged.String(), "environment failure"), "")
+}
+
+func TestEvolveEarlyStopping(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseWeightMutProb = 1
+	})
+
+	// The fitness is capped so the best fitness converges within a few
+	// generations
+	eval := func(org *organism) float64 {
+		return math.Min(0, weightSensitiveEval(org)+0.5)
+	}
+
+	org := newOrganism(1, 1)
+	organisms := []*organism{org}
+	for i := 0; i < 9; i++ {
+		organisms = append(organisms, org.clone())
+	}
+	population := newPopulationFrom(1, 1, organisms)
+
+	maxGenerations := 100
+	options := EvolutionOptions{
+		EarlyStoppingWindow:    3,
+		EarlyStoppingThreshold: 1e-6,
+	}
+	champion := population.Evolve(eval, maxGenerations, options)
+
+	require.True(t, population.Generation() < maxGenerations, "")
+	require.Equal(t, 0.0, champion.fitness, "")
+}
+
+func TestEvolveWithoutEarlyStopping(t *testing.T) {
+	withSeed(t, 1)
+
+	org := newOrganism(1, 1)
+	population := newPopulationFrom(1, 1, []*organism{org, org.clone()})
+	population.Evolve(weightSensitiveEval, 5, EvolutionOptions{})
+
+	require.Equal(t, 5, population.Generation(), "")
+
+	// An empty population has no champion
+	empty := newPopulationFrom(1, 1, nil)
+	require.Nil(t, empty.Evolve(weightSensitiveEval, 5, EvolutionOptions{}), "")
+}
+
+// Is every gene of the champion also a gene of the organism
+func hasAllGenes(org, champion *organism) bool {
+	for _, g := range champion.genes {
+		if !hasInnovation(org, g.getInnovation()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestInjectChampion(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.ExcessGenesCoeff = 1
+		c.SpeciesConfig.DisjoinGenesCoeff = 1
+	})
+
+	population, eval := createTwoNichePopulation(6)
+	population.evaluate(eval)
+	population.species = speciate(nil, population.organisms)
+	require.Equal(t, 2, len(population.species), "")
+
+	champion := population.Champion()
+	champion.age = 3
+	population.InjectChampion()
+
+	for _, s := range population.species {
+		found := false
+		for _, org := range s.population {
+			found = found || hasAllGenes(org, champion)
+		}
+		require.True(t, found, "")
+	}
+
+	// The injected copy is added to the population and starts out young
+	require.Equal(t, 7, len(population.organisms), "")
+	injected := 0
+	for _, org := range population.organisms {
+		if hasAllGenes(org, champion) && org.species != champion.species {
+			require.Equal(t, 0, org.age, "")
+			require.Equal(t, champion.fitness, org.fitness, "")
+			injected++
+		}
+	}
+	require.Equal(t, 1, injected, "")
+
+	// Step injects the champion and makes room for it again
+	population, eval = createTwoNichePopulation(6)
+	population.Step(eval)
+	population.Step(eval)
+	require.Equal(t, 6, len(population.organisms), "")
+}
+
+func TestAFPO(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseWeightMutProb = 0
+		c.PopulationConfig.DiversityMode = DiversityAFPO
+	})
+
+	// An old lineage sitting on the optimum
+	old := newOrganism(1, 1)
+	old.genes[2].(*synapse).weight = 0.7
+	old.age = 100
+	organisms := []*organism{old}
+	for i := 0; i < 9; i++ {
+		organisms = append(organisms, old.clone())
+		organisms[i+1].age = old.age
+	}
+	population := newPopulationFrom(1, 1, organisms)
+
+	for i := 0; i < 5; i++ {
+		population.Step(weightSensitiveEval)
+	}
+
+	// The less fit newcomers survive on their youth
+	young := 0
+	for _, org := range population.organisms {
+		if org.age < 100 {
+			young++
+		}
+	}
+	require.True(t, young > 0, "")
+	require.Equal(t, 10, len(population.organisms), "")
+	require.InDelta(t, 0, population.Champion().fitness, 1e-9, "")
+}
+
+func TestDistinctTopologies(t *testing.T) {
+	org := newOrganism(2, 2)
+	clones := []*organism{org}
+	for i := 0; i < 4; i++ {
+		clone := org.clone()
+		clone.mutateWeight(clone.genes[4].(*synapse).id, config.OrganismConfig.SynapseWeightBound)
+		clones = append(clones, clone)
+	}
+
+	population := newPopulationFrom(2, 2, clones)
+	require.Equal(t, 1, population.DistinctTopologies(), "")
+	require.Equal(t, map[uint64]int{org.topologyHash(): 5}, population.TopologyHistogram(), "")
+
+	// Split a synapse in one clone and disable one in another
+	clones[1].splitSynapse(clones[1].genes[4].(*synapse).id)
+	clones[2].toggleEnabled(clones[2].genes[5].(*synapse).id)
+
+	require.Equal(t, 3, population.DistinctTopologies(), "")
+	histogram := population.TopologyHistogram()
+	require.Equal(t, 3, histogram[org.topologyHash()], "")
+	require.Equal(t, 1, histogram[clones[1].topologyHash()], "")
+}
+
+func TestInitialConnectProb(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.InitialConnectProb = 0.5
+		c.PopulationConfig.Size = 1000
+	})
+
+	nInputs, nOutputs := 8, 3
+	population := NewPopulation(nInputs, nOutputs, PopulationOptions{})
+
+	synapses := 0
+	for _, org := range population.organisms {
+		connected := make(map[neuronID]bool)
+		for _, s := range org.synapses {
+			connected[s.out] = true
+		}
+		for _, id := range org.outputs {
+			require.True(t, connected[id], "")
+		}
+
+		synapses += len(org.synapses)
+	}
+
+	density := float64(synapses) / float64(len(population.organisms)*nInputs*nOutputs)
+	require.InDelta(t, 0.5, density, 0.02, "")
+}
+
+func TestRandomInjection(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseAddMutProb = 0
+		c.PopulationConfig.RandomInjectionCount = 3
+	})
+
+	org := newOrganism(2, 1)
+	organisms := []*organism{org}
+	for i := 0; i < 9; i++ {
+		organisms = append(organisms, org.clone())
+	}
+	population := newPopulationFrom(2, 1, organisms)
+
+	eval := func(org *organism) float64 {
+		return org.process([]float64{1, 1})[0]
+	}
+
+	for i := 0; i < 5; i++ {
+		// The organisms that weren't evaluated with the offspring are the
+		// fresh ones
+		offspring := make(map[*organism]bool)
+		population.beforeEvaluate = func(organisms []*organism) {
+			for _, org := range organisms {
+				offspring[org] = true
+			}
+		}
+		population.Step(eval)
+
+		fresh := 0
+		for _, org := range population.organisms {
+			if offspring[org] {
+				continue
+			}
+			fresh++
+
+			// Its genes line up with those of the other organisms
+			diff := GenomeDiff(population.organisms[0], org)
+			require.Equal(t, 0, len(diff.AddedNeurons)+len(diff.RemovedNeurons), "")
+			require.Equal(t, 0, len(diff.AddedSynapses)+len(diff.RemovedSynapses), "")
+		}
+		require.Equal(t, 3, fresh, "")
+		require.Equal(t, 10, len(population.organisms), "")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	withSeed(t, 1)
+
+	org := newOrganism(1, 1)
+	population := newPopulationFrom(1, 1, []*organism{org, org.clone(), org.clone()})
+	population.Evolve(weightSensitiveEval, 7, EvolutionOptions{})
+
+	history := population.History()
+	require.Equal(t, population.Generation(), len(history), "")
+	for i, stats := range history {
+		require.Equal(t, i+1, stats.Generation, "")
+		require.True(t, stats.MinFitness <= stats.MeanFitness, "")
+		require.True(t, stats.MeanFitness <= stats.MaxFitness, "")
+	}
+	require.Equal(t, population.Champion().fitness, history[6].MaxFitness, "")
+}
+
+func TestRepresentativeStrategy(t *testing.T) {
+	withSeed(t, 1)
+
+	organisms := createPopulation(0.3, 0.9, 0.1, 0.9, 0.5)
+	base := organisms[0]
+	for i := range organisms {
+		clone := base.clone()
+		clone.fitness = organisms[i].fitness
+		organisms[i] = clone
+	}
+
+	fittest := func(s *Species) *organism {
+		best := s.population[0]
+		for _, org := range s.population {
+			if fitter(org, best) {
+				best = org
+			}
+		}
+		return best
+	}
+
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.ExcessGenesCoeff = 1
+		c.SpeciesConfig.DisjoinGenesCoeff = 1
+		c.SpeciesConfig.RepresentativeStrategy = RepresentativeChampion
+	})
+	niches, _ := createTwoNichePopulation(8)
+	for i, org := range niches.organisms {
+		org.fitness = []float64{0.2, 0.4, 0.9, 0.1, 0.5, 0.8, 0.3, 0.6}[i]
+	}
+	species := speciate(nil, niches.organisms)
+	require.Equal(t, 2, len(species), "")
+	for _, s := range species {
+		require.Equal(t, fittest(s), s.representative(), "")
+	}
+
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.RepresentativeStrategy = RepresentativeFirst
+	})
+	require.Equal(t, organisms[0], speciate(nil, organisms)[0].representative(), "")
+
+	// Every member is picked as the random representative now and then
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.RepresentativeStrategy = RepresentativeRandom
+	})
+	picked := make(map[*organism]bool)
+	for i := 0; i < 100; i++ {
+		picked[speciate(nil, organisms)[0].representative()] = true
+	}
+	require.Equal(t, len(organisms), len(picked), "")
+}
+
+// Three clusters of ten organisms that only differ in their weights,
+// every cluster is far from the others
+func createClusters(base *organism) ([]*organism, map[*organism]int) {
+	var organisms []*organism
+	clusterOf := make(map[*organism]int)
+	for cluster, weight := range []float64{-20, 0, 20} {
+		for i := 0; i < 10; i++ {
+			org := base.clone()
+			for _, g := range org.genes {
+				if s, ok := g.(*synapse); ok {
+					s.weight = weight + 0.1*RandFloat64()
+				}
+			}
+			organisms = append(organisms, org)
+			clusterOf[org] = cluster
+		}
+	}
+
+	return organisms, clusterOf
+}
+
+func TestSpeciesCount(t *testing.T) {
+	withSeed(t, 1)
+
+	organisms, clusterOf := createClusters(newOrganism(2, 1))
+
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.AvgWeightDiffCoeff = 1
+		c.SpeciesConfig.CompatibilityThreshold = 100
+	})
+	require.Equal(t, 1, len(speciate(nil, organisms)), "")
+
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.AvgWeightDiffCoeff = 1
+		c.SpeciesConfig.CompatibilityThreshold = 100
+		c.SpeciesConfig.SpeciesCount = 3
+	})
+	var species []*Species
+	idOf := make(map[int]uint64)
+	for i := 0; i < 10; i++ {
+		species = speciate(species, organisms)
+		require.Equal(t, 3, len(species), "")
+
+		for _, s := range species {
+			require.Equal(t, 10, len(s.population), "")
+			require.Equal(t, i, s.Age(), "")
+			for _, org := range s.population {
+				require.Equal(t, clusterOf[s.representative()], clusterOf[org], "")
+				require.Equal(t, s.id, org.species, "")
+			}
+		}
+
+		// The clusters keep their species from one generation to the next
+		for _, org := range organisms {
+			if i == 0 {
+				idOf[clusterOf[org]] = org.species
+			}
+			require.Equal(t, idOf[clusterOf[org]], org.species, "")
+		}
+	}
+}
+
+func TestSpeciesPersistence(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.AvgWeightDiffCoeff = 1
+		c.SpeciesConfig.CompatibilityThreshold = 5
+	})
+
+	base := newOrganism(2, 1)
+	organisms, clusterOf := createClusters(base)
+	species := speciate(nil, organisms)
+	require.Equal(t, 3, len(species), "")
+
+	idOf := make(map[int]uint64)
+	for _, org := range organisms {
+		idOf[clusterOf[org]] = org.species
+	}
+
+	// Every generation is made of new organisms, the clusters keep their
+	// species
+	for generation := 0; generation < 5; generation++ {
+		organisms, clusterOf = createClusters(base)
+		species = speciate(species, organisms)
+		require.Equal(t, 3, len(species), "")
+
+		for _, org := range organisms {
+			require.Equal(t, idOf[clusterOf[org]], org.species, "")
+		}
+	}
+
+	// Species without members die out
+	species = speciate(species, organisms[:10])
+	require.Equal(t, 1, len(species), "")
+	require.Equal(t, idOf[0], species[0].id, "")
+}
+
+func TestPerSpeciesThreshold(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.CompatibilityThreshold = 2
+		c.SpeciesConfig.PerSpeciesThreshold = true
+		c.SpeciesConfig.TargetSpeciesSize = 10
+	})
+
+	require.Equal(t, 1.0, speciesThreshold(20), "")
+	require.Equal(t, 2.0, speciesThreshold(10), "")
+	require.Equal(t, 4.0, speciesThreshold(5), "")
+
+	config.SpeciesConfig.PerSpeciesThreshold = false
+	require.Equal(t, 2.0, speciesThreshold(20), "")
+}
+
+func TestSpeciateWithPerSpeciesThreshold(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.SpeciesConfig.AvgWeightDiffCoeff = 1
+		c.SpeciesConfig.PerSpeciesThreshold = true
+		c.SpeciesConfig.TargetSpeciesSize = 10
+	})
+
+	base := newOrganism(2, 1)
+	shifted := base.clone()
+	for _, g := range shifted.genes {
+		if s, ok := g.(*synapse); ok {
+			s.weight += 1
+		}
+	}
+	d := compatibilityDistance(base, shifted)
+	require.True(t, d > 0, "")
+
+	speciesOfSize := func(size int) *Species {
+		s := newSpecies(base)
+		for len(s.population) < size {
+			s.add(base.clone())
+		}
+		return s
+	}
+
+	// Twice the target size halves the threshold, the organism is within
+	// the global threshold but founds a new species
+	config.SpeciesConfig.CompatibilityThreshold = 1.5 * d
+	species := speciate([]*Species{speciesOfSize(20)}, []*organism{base.clone(), shifted.clone()})
+	require.Equal(t, 2, len(species), "")
+
+	// Half the target size doubles the threshold, the organism is outside
+	// the global threshold but joins the species
+	config.SpeciesConfig.CompatibilityThreshold = 0.75 * d
+	species = speciate([]*Species{speciesOfSize(5)}, []*organism{base.clone(), shifted.clone()})
+	require.Equal(t, 1, len(species), "")
+}
+
+func BenchmarkEvolveGeneration(b *testing.B) {
+	withSeed(b, 1)
+	withConfig(b, func(c *NeatConfig) {
+		c.SpeciesConfig.ExcessGenesCoeff = 1
+		c.SpeciesConfig.DisjoinGenesCoeff = 1
+		c.SpeciesConfig.AvgWeightDiffCoeff = 0.4
+		c.SpeciesConfig.CompatibilityThreshold = 3
+		c.OrganismConfig.SynapseSplitMutProb = 0.02
+		c.OrganismConfig.SynapseAddMutProb = 0.02
+		c.OrganismConfig.SynapseWeightMutProb = 0.2
+		c.OrganismConfig.actFunc = Sigmoid
+		c.PopulationConfig.Size = 150
+	})
+
+	// XOR with a bias input
+	cases := [][3]float64{{0, 0, 0}, {0, 1, 1}, {1, 0, 1}, {1, 1, 0}}
+	eval := func(org *organism) float64 {
+		fitness := 4.0
+		for _, c := range cases {
+			out := org.processFeedforward([]float64{c[0], c[1], 1})
+			fitness -= math.Abs(out[0] - c[2])
+		}
+		return fitness
+	}
+
+	// Start over now and then so that the networks stay as large as they
+	// are during a typical run
+	const restartEvery = 10
+
+	var p *Population
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%restartEvery == 0 {
+			b.StopTimer()
+			p = NewPopulation(3, 1, PopulationOptions{})
+			b.StartTimer()
+		}
+
+		p.Step(eval)
+	}
+}
+
+func TestAssignSpeciesByBehavior(t *testing.T) {
+	a := newOrganism(2, 1)
+	b := a.clone()
+	c := a.clone()
+
+	// Same structure, b behaves like a and c doesn't
+	for _, g := range c.genes {
+		if s, ok := g.(*synapse); ok {
+			s.weight = -s.weight
+		}
+	}
+
+	inputs := [][]float64{{1, 0}, {0, 1}, {1, 1}}
+	require.Equal(t, 0.0, BehavioralDistance(a, b, inputs), "")
+	require.True(t, BehavioralDistance(a, c, inputs) > 1, "")
+
+	// Genetically they are all the same species
+	require.Equal(t, 1, len(speciate(nil, []*organism{a, b, c})), "")
+
+	species := AssignSpeciesByBehavior([]*organism{a, b, c}, inputs, 0.1)
+	require.Equal(t, 2, len(species), "")
+	require.Equal(t, []*organism{a, b}, species[0].population, "")
+	require.Equal(t, []*organism{c}, species[1].population, "")
+}
+
+func TestResize(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+	})
+
+	p := NewPopulation(2, 1, PopulationOptions{})
+	eval := func(org *organism) float64 {
+		return org.process([]float64{1, 1})[0]
+	}
+	p.Step(eval)
+	require.Equal(t, config.PopulationConfig.Size, p.Size(), "")
+
+	// The new size takes effect at the next generation
+	p.Resize(2 * p.Size())
+	require.Equal(t, config.PopulationConfig.Size, p.Size(), "")
+	p.Step(eval)
+	require.Equal(t, 2*config.PopulationConfig.Size, p.Size(), "")
+	p.Step(eval)
+	require.Equal(t, 2*config.PopulationConfig.Size, p.Size(), "")
+
+	// The best organism survives a shrink
+	best := p.Champion().fitness
+	p.Resize(3)
+	p.Step(eval)
+	require.Equal(t, 3, p.Size(), "")
+	require.True(t, p.Champion().fitness >= best, "")
+
+	p.Resize(0)
+	p.Step(eval)
+	require.Equal(t, 1, p.Size(), "")
+}
+
+func TestSpeciesAccessors(t *testing.T) {
+	organisms := createPopulation(0.2, 0.8, 0.5)
+	s := &Species{id: 1, age: 4}
+	for _, org := range organisms {
+		s.add(org)
+	}
+
+	require.Equal(t, 3, s.Size(), "")
+	require.Equal(t, organisms[1], s.Champion(), "")
+	require.Equal(t, 0.8, s.BestFitness(), "")
+	require.InDelta(t, 0.5, s.MeanFitness(), 1e-9, "")
+	require.Equal(t, 4, s.Age(), "")
+
+	empty := &Species{}
+	require.Equal(t, 0, empty.Size(), "")
+	require.Nil(t, empty.Champion(), "")
+	require.Equal(t, 0.0, empty.BestFitness(), "")
+	require.Equal(t, 0.0, empty.MeanFitness(), "")
+
+	// Species that carry over to the next generation grow older
+	next := speciate([]*Species{s}, organisms)
+	require.Equal(t, 5, next[0].Age(), "")
+}
+
+func TestAllocateOffspring(t *testing.T) {
+	speciesOf := func(fitness ...float64) *Species {
+		s := &Species{}
+		for _, org := range createPopulation(fitness...) {
+			s.add(org)
+		}
+		return s
+	}
+
+	sum := func(allocation []int) int {
+		total := 0
+		for _, n := range allocation {
+			total += n
+		}
+		return total
+	}
+
+	// Mean fitnesses 1, 2 and 1
+	species := []*Species{speciesOf(1, 1), speciesOf(1, 3), speciesOf(0.5, 1.5)}
+	allocation := AllocateOffspring(species, 100)
+	require.Equal(t, 100, sum(allocation), "")
+	require.Equal(t, []int{25, 50, 25}, allocation, "")
+
+	// The remainders go to the largest fractional parts, 33.3 and 66.7
+	allocation = AllocateOffspring(species[:2], 100)
+	require.Equal(t, []int{33, 67}, allocation, "")
+
+	for _, total := range []int{0, 1, 7, 150} {
+		require.Equal(t, total, sum(AllocateOffspring(species, total)), "")
+	}
+
+	// Without any fitness the offspring are divided evenly
+	require.Equal(t, []int{2, 1, 1}, AllocateOffspring([]*Species{speciesOf(0), speciesOf(0), speciesOf(0)}, 4), "")
+	require.Equal(t, []int{}, AllocateOffspring(nil, 10), "")
+}
+
+func TestZeroFitnessReproduction(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseWeightMutProb = 0
+		c.PopulationConfig.Size = 20
+	})
+
+	// A greedy selection would always pick the same parent
+	p := NewPopulation(2, 1, PopulationOptions{})
+	p.Selection = NewBoltzmannSelection(0)
+	p.Step(func(*organism) float64 { return 0 })
+	require.Equal(t, 20, p.Size(), "")
+	require.True(t, len(p.Species()) > 0, "")
+
+	// Without mutations the offspring carry the weights of their parents
+	distinct := make(map[float64]bool)
+	for _, org := range p.organisms {
+		distinct[org.genes[len(org.genes)-1].(*synapse).weight] = true
+	}
+	require.True(t, len(distinct) > 5, "")
+}
+
+func TestNegativeFitness(t *testing.T) {
+	withSeed(t, 1)
+
+	require.Equal(t, []float64{1, 2}, positiveFitness([]float64{1, 2}), "")
+	require.Equal(t, []float64{3.03, 2.03, 0.03}, roundAll(positiveFitness([]float64{-1, -2, -4})), "")
+	require.Equal(t, []float64{0.02, 0.02}, roundAll(positiveFitness([]float64{-2, -2})), "")
+
+	// The least negative species gets the most offspring
+	species := make([]*Species, 3)
+	for i, fitness := range []float64{-1, -2, -4} {
+		species[i] = &Species{}
+		species[i].add(createPopulation(fitness)[0])
+	}
+	allocation := AllocateOffspring(species, 100)
+	require.True(t, allocation[0] > allocation[1], "")
+	require.True(t, allocation[1] > allocation[2], "")
+	require.True(t, allocation[2] > 0, "")
+
+	// and the least negative organism is selected the most
+	organisms := createPopulation(-1, -2, -4)
+	for _, selection := range []SelectionStrategy{NewTournamentSelection(2), NewBoltzmannSelection(1)} {
+		counts := make(map[*organism]int)
+		for i := 0; i < 1000; i++ {
+			counts[selection.Select(organisms)]++
+		}
+		require.True(t, counts[organisms[0]] > counts[organisms[1]], "")
+		require.True(t, counts[organisms[1]] > counts[organisms[2]], "")
+	}
+}
+
+// Round to two decimals
+func roundAll(values []float64) []float64 {
+	rounded := make([]float64, len(values))
+	for i, v := range values {
+		rounded[i] = math.Round(v*100) / 100
+	}
+	return rounded
+}
+
+func TestSeedPopulation(t *testing.T) {
+	withSeed(t, 1)
+
+	// The organisms are mutated under the given configuration, which isn't
+	// made the global configuration
+	cfg := testConfig
+	cfg.OrganismConfig.SynapseWeightBound = 100
+
+	seed := createRandomOrganism(3, 2, 4, 3)
+	organisms := SeedPopulation(seed, 20, cfg)
+	require.Equal(t, testConfig.OrganismConfig.SynapseWeightBound, config.OrganismConfig.SynapseWeightBound, "")
+	require.Equal(t, 20, len(organisms), "")
+	require.True(t, GenomeDiff(seed, organisms[0]).Empty(), "")
+
+	changed := 0
+	for _, org := range organisms {
+		require.Equal(t, len(seed.neurons), len(org.neurons), "")
+		require.True(t, org != seed, "")
+
+		if !GenomeDiff(seed, org).Empty() {
+			changed++
+		}
+	}
+	require.True(t, changed >= 10, "")
+
+	// Mutated weights are drawn from the given bound
+	beyond := false
+	for _, org := range organisms {
+		for _, s := range org.synapses {
+			beyond = beyond || math.Abs(s.weight) > testConfig.OrganismConfig.SynapseWeightBound
+		}
+	}
+	require.True(t, beyond, "")
+}
+
+func TestEvaluate(t *testing.T) {
+	// The recurrent network outputs 1, 1, 1, 2 for the inputs 1, 0, 0, 1
+	org := createSimpleRecurrent()
+	score := func(org *organism) float64 {
+		var sum float64
+		for _, input := range []float64{1, 0, 0, 1} {
+			sum += org.process([]float64{input})[0]
+		}
+		return sum
+	}
+
+	require.Equal(t, 5.0, Evaluate(org, score), "")
+	require.Equal(t, 5.0, org.fitness, "")
+
+	// The recurrent signal of the last input is forgotten
+	require.Equal(t, 5.0, Evaluate(org, score), "")
+}
+
+func TestParallelEvaluation(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 50
+	})
+
+	score := func(org *organism) float64 {
+		return org.processFeedforward([]float64{1, 0.5})[0]
+	}
+
+	population := NewPopulation(2, 1, PopulationOptions{Workers: 4})
+	population.evaluate(score)
+
+	for _, org := range population.organisms {
+		require.Equal(t, score(org), org.fitness, "")
+	}
+
+	// The offspring are evaluated by the workers in every diversity mode
+	for _, mode := range []string{DiversityCrowding, DiversityAFPO} {
+		withConfig(t, func(c *NeatConfig) {
+			c.PopulationConfig.Size = 20
+			c.PopulationConfig.DiversityMode = mode
+		})
+
+		var running, most atomic.Int32
+		slow := func(org *organism) float64 {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			return score(org)
+		}
+
+		population := NewPopulation(2, 1, PopulationOptions{Workers: 4})
+		population.Step(score)
+		population.Step(slow)
+		require.True(t, most.Load() > 1, "")
+	}
+}
+
+func TestPanickingEvaluation(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 20
+	})
+
+	var logged bytes.Buffer
+	options := PopulationOptions{
+		Workers:        4,
+		FailureFitness: math.Inf(-1),
+		Logger:         log.New(&logged, "", 0),
+	}
+	t.Cleanup(func() { Logger = nil })
+	population := NewPopulation(2, 1, options)
+	bad := population.organisms[3]
+
+	eval := func(org *organism) float64 {
+		if org == bad {
+			panic("environment failure")
+		}
+		return 1
+	}
+
+	population.evaluate(eval)
+	require.Equal(t, math.Inf(-1), bad.fitness, "")
+	for _, org := range population.organisms {
+		if org != bad {
+			require.Equal(t, 1.0, org.fitness, "")
+		}
+	}
+	require.True(t, strings.Contains(logged.String(), "environment failure"), "")
+
+	// A run where every evaluation panics still completes
+	for i := 0; i < 3; i++ {
+		population.Step(func(*organism) float64 { panic("always") })
+	}
+	require.Equal(t, 3, population.Generation(), "")
+	require.Equal(t, math.Inf(-1), population.Champion().fitness, "")
+}
+
+func TestStochasticEval(t *testing.T) {
+	withSeed(t, 1)
+
+	org := newOrganism(2, 1)
+	noisy := func(*organism) float64 {
+		return 3 + 2*randNormFloat64()
+	}
+
+	// The mean of the trials approaches the true mean
+	errors := make(map[int]float64)
+	for _, n := range []int{1, 10, 10000} {
+		errors[n] = math.Abs(StochasticEval(org, noisy, n) - 3)
+	}
+	require.True(t, errors[10000] < errors[10], "")
+	require.True(t, errors[10000] < errors[1], "")
+	require.InDelta(t, 3, StochasticEval(org, noisy, 10000), 0.1, "")
+	require.InDelta(t, 2, org.StdDev(), 0.1, "")
+
+	// Every organism of a population is evaluated FitnessEvalTrials times
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+		c.PopulationConfig.FitnessEvalTrials = 5
+	})
+
+	calls := 0
+	population := NewPopulation(2, 1, PopulationOptions{})
+	population.Step(func(*organism) float64 {
+		calls++
+		return 1
+	})
+	require.Equal(t, 2*10*5, calls, "")
+	require.Equal(t, 1.0, population.Champion().fitness, "")
+	require.Equal(t, 0.0, population.Champion().StdDev(), "")
+}
+
+func TestNewPopulationFromConfig(t *testing.T) {
+	withConfig(t, func(*NeatConfig) {})
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := strings.Replace(testConfigJSON, "\n}", `,
+	"PopulationConfig": {
+		"Size": 15
+	}
+}`, 1)
+	require.NoError(t, os.WriteFile(path, []byte(cfg), 0644), "")
+
+	population, err := NewPopulationFromConfig(path, 3, 2)
+	require.NoError(t, err, "")
+	require.Equal(t, 15, population.Size(), "")
+	for _, org := range population.organisms {
+		require.Equal(t, 3, len(org.sensors), "")
+		require.Equal(t, 2, len(org.outputs), "")
+		require.Equal(t, 5, len(org.neurons), "")
+	}
+
+	// The configuration is ready to evolve with
+	population.Step(func(org *organism) float64 {
+		return org.processFeedforward([]float64{1, 0, 1})[0]
+	})
+	require.Equal(t, 15, population.Size(), "")
+
+	_, err = NewPopulationFromConfig(filepath.Join(t.TempDir(), "missing.json"), 3, 2)
+	require.Error(t, err, "")
+	_, err = NewPopulationFromConfig(path, 0, 2)
+	require.Error(t, err, "")
+}
+
+func TestFitnessTrials(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 100
+	})
+
+	// Every organism is equally good, the evaluation is noisy
+	noisy := func(*organism) float64 {
+		return 1 + randNormFloat64()
+	}
+	variance := func(population *Population) float64 {
+		mean := population.stats().MeanFitness
+		var total float64
+		for _, org := range population.organisms {
+			total += (org.fitness - mean) * (org.fitness - mean)
+		}
+		return total / float64(population.Size())
+	}
+
+	population := NewPopulation(2, 1, PopulationOptions{})
+	population.evaluate(trialEval(noisy))
+	single := variance(population)
+
+	config.PopulationConfig.FitnessEvalTrials = 20
+	population.evaluate(trialEval(noisy))
+	averaged := variance(population)
+	require.True(t, averaged < single/5, "")
+	require.InDelta(t, 1, population.stats().MeanFitness, 0.1, "")
+
+	// The lowest trial is below the mean
+	config.PopulationConfig.FitnessTrialAggregation = TrialsMin
+	population.evaluate(trialEval(noisy))
+	require.True(t, population.stats().MaxFitness < 1, "")
+
+	// Every trial starts out at rest, a recurrent network gives the same
+	// output every time
+	recurrent := createSimpleRecurrent()
+	output := func(org *organism) float64 {
+		return org.process([]float64{1})[0]
+	}
+	require.Equal(t, 1.0, trialEval(output)(recurrent), "")
+	require.Equal(t, 0.0, recurrent.StdDev(), "")
+}
+
+func TestPopulationElitism(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0.05
+		c.OrganismConfig.SynapseAddMutProb = 0.1
+		c.OrganismConfig.SynapseWeightMutProb = 0.5
+		c.PopulationConfig.Size = 20
+		c.PopulationConfig.PopulationElitism = 3
+	})
+
+	eval := func(org *organism) float64 {
+		return -math.Abs(org.processFeedforward([]float64{1, 1})[0] - 0.7)
+	}
+
+	population := NewPopulation(2, 1, PopulationOptions{})
+	population.Step(eval)
+
+	best := population.Champion().fitness
+	for i := 0; i < 20; i++ {
+		elites := make([]*organism, len(population.organisms))
+		copy(elites, population.organisms)
+		sort.SliceStable(elites, func(i, j int) bool { return fitter(elites[i], elites[j]) })
+		elites = elites[:3]
+
+		population.Step(eval)
+
+		// The best fitness never regresses
+		require.True(t, population.Champion().fitness >= best, "")
+		best = population.Champion().fitness
+
+		// and the three fittest organisms made it into the next generation
+		for _, elite := range elites {
+			found := false
+			for _, org := range population.organisms {
+				if GenomeDiff(elite, org).Empty() && len(elite.genes) == len(org.genes) {
+					found = true
+					break
+				}
+			}
+			require.True(t, found, "")
+		}
+	}
+}
+
+func TestMutationDecay(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0.2
+		c.OrganismConfig.SynapseWeightMutProb = 0.4
+		c.OrganismConfig.SynapseAddMutProb = 0.1
+		c.OrganismConfig.MutationDecayRate = 0.5
+		c.OrganismConfig.MutationDecayInterval = 3
+		c.OrganismConfig.MinMutationRate = 0.05
+		c.PopulationConfig.Size = 10
+	})
+
+	population := NewPopulation(2, 1, PopulationOptions{})
+
+	// The decayed rates are handed to the mutations, the configuration
+	// stays the same while stepping
+	eval := func(org *organism) float64 {
+		require.Equal(t, 0.4, config.OrganismConfig.SynapseWeightMutProb, "")
+		return 0
+	}
+
+	for i := 0; i < 6; i++ {
+		rates := population.CurrentMutationRates()
+		require.InDelta(t, 0.4*math.Pow(0.5, float64(i/3)), rates.SynapseWeightMutProb, 1e-12, "")
+		population.Step(eval)
+	}
+
+	rates := population.CurrentMutationRates()
+	require.InDelta(t, 0.4*0.5*0.5, rates.SynapseWeightMutProb, 1e-12, "")
+	require.InDelta(t, 0.2*0.5*0.5, rates.SynapseActivityMutProb, 1e-12, "")
+
+	// The floor is never crossed, a lower probability is left as it is
+	require.Equal(t, 0.05, rates.SynapseAddMutProb, "")
+	require.Equal(t, 0.0, rates.SynapseSplitMutProb, "")
+
+	// The configuration itself doesn't change
+	require.Equal(t, 0.4, config.OrganismConfig.SynapseWeightMutProb, "")
+}
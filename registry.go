@@ -0,0 +1,50 @@
+package neat
+
+import "sync"
+
+// A registry of organisms by id that is safe for concurrent use, e.g. by
+// evaluation workers that only know the id of the organism to evaluate
+type OrganismRegistry struct {
+	mu        sync.RWMutex
+	organisms map[uint64]*organism
+}
+
+func newOrganismRegistry() *OrganismRegistry {
+	return &OrganismRegistry{organisms: make(map[uint64]*organism)}
+}
+
+// Register an organism, replacing any organism with the same id
+func (r *OrganismRegistry) Register(org *organism) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.organisms[org.id] = org
+}
+
+// Lookup an organism by id
+func (r *OrganismRegistry) Lookup(id uint64) (*organism, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	org, ok := r.organisms[id]
+	return org, ok
+}
+
+// Remove an organism from the registry
+func (r *OrganismRegistry) Deregister(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.organisms, id)
+}
+
+// Replace the content of the registry with the given organisms
+func (r *OrganismRegistry) reset(organisms []*organism) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.organisms = make(map[uint64]*organism, len(organisms))
+	for _, org := range organisms {
+		r.organisms[org.id] = org
+	}
+}
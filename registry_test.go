@@ -0,0 +1,53 @@
+package neat
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganismRegistryConcurrent(t *testing.T) {
+	r := newOrganismRegistry()
+
+	organisms := make([]*organism, 100)
+	for i := range organisms {
+		organisms[i] = newOrganism(1, 1)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(organisms); i += 8 {
+				r.Register(organisms[i])
+				r.Lookup(organisms[(i+1)%len(organisms)].id)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, org := range organisms {
+		found, ok := r.Lookup(org.id)
+		require.True(t, ok, "")
+		require.Equal(t, org, found, "")
+	}
+
+	r.Deregister(organisms[0].id)
+	_, ok := r.Lookup(organisms[0].id)
+	require.False(t, ok, "")
+}
+
+func TestPopulationRegistry(t *testing.T) {
+	withSeed(t, 1)
+
+	p := NewPopulation(2, 1, PopulationOptions{})
+	p.Step(func(org *organism) float64 { return float64(len(org.genes)) })
+
+	for _, org := range p.organisms {
+		found, ok := p.Registry().Lookup(org.id)
+		require.True(t, ok, "")
+		require.Equal(t, org, found, "")
+	}
+}
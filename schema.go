@@ -0,0 +1,119 @@
+package neat
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// A JSON Schema (draft-07) describing the configuration file, the bounds
+// match the ones enforced when a configuration is read
+func NeatConfigJSONSchema() string {
+	type object = map[string]interface{}
+
+	number := func(minimum float64) object {
+		return object{"type": "number", "minimum": minimum}
+	}
+	probability := func() object {
+		return object{"type": "number", "minimum": 0, "maximum": 1}
+	}
+	integer := func(minimum int) object {
+		return object{"type": "integer", "minimum": minimum}
+	}
+	deprecated := func(property object, replacement string) object {
+		property["description"] = "Deprecated, use " + replacement
+		return property
+	}
+
+	actFuncs := make([]string, 0, len(actFuncNameMap))
+	for name := range actFuncNameMap {
+		actFuncs = append(actFuncs, name)
+	}
+	sort.Strings(actFuncs)
+
+	species := object{
+		"type": "object",
+		"properties": object{
+			"ExcessGenesCoeff":       number(0),
+			"DisjoinGenesCoeff":      number(0),
+			"AvgWeightDiffCoeff":     number(0),
+			"CompatibilityThreshold": number(0),
+			"RepresentativeStrategy": object{
+				"type": "string",
+				"enum": []string{"", RepresentativeFirst, RepresentativeRandom, RepresentativeChampion},
+			},
+			"SpeciesCount":        integer(0),
+			"PerSpeciesThreshold": object{"type": "boolean"},
+			"TargetSpeciesSize":   integer(0),
+		},
+	}
+
+	organism := object{
+		"type": "object",
+		"properties": object{
+			"SynapseSplitMutProb":         probability(),
+			"SynapseActivityMutProb":      probability(),
+			"SynapseWeightMutProb":        probability(),
+			"SynapseWeightMutProp":        deprecated(probability(), "SynapseWeightMutProb"),
+			"SynapseWeightBound":          object{"type": "number", "exclusiveMinimum": 0},
+			"SynapseAddMutProb":           probability(),
+			"MaxConnectionDensity":        probability(),
+			"MaxNeurons":                  integer(0),
+			"MaxSynapses":                 integer(0),
+			"InitialConnectProb":          probability(),
+			"CorrelatedWeightMutation":    number(0),
+			"RegulationMutProb":           probability(),
+			"PostMatingHillClimbSteps":    integer(0),
+			"SumClamp":                    number(0),
+			"HebbianLearningRate":         number(0),
+			"NormalizeWeightsAfterMating": object{"type": "boolean"},
+			"MutationDecayRate":           probability(),
+			"MutationDecayInterval":       integer(0),
+			"MinMutationRate":             probability(),
+			"ActFunc":                     object{"type": "string", "enum": actFuncs},
+			"OutputActFunc":               object{"type": "string", "enum": append([]string{""}, actFuncs...)},
+		},
+		"required": []string{"ActFunc", "SynapseWeightBound"},
+	}
+
+	population := object{
+		"type": "object",
+		"properties": object{
+			"Size": integer(0),
+			"DiversityMode": object{
+				"type": "string",
+				"enum": []string{"", DiversityElitism, DiversityCrowding, DiversityAFPO},
+			},
+			"LocalSearch":          object{"type": "boolean"},
+			"LocalSearchSteps":     integer(0),
+			"LocalSearchOrganisms": integer(0),
+			"MultiObjective":       object{"type": "boolean"},
+			"RandomInjectionCount": integer(0),
+			"PopulationElitism":    integer(0),
+			"FitnessEvalTrials":    integer(0),
+			"FitnessTrialAggregation": object{
+				"type": "string",
+				"enum": []string{"", TrialsMean, TrialsMin},
+			},
+			"FitnessTransform": object{
+				"type": "string",
+				"enum": []string{"", FitnessTransformExp, FitnessTransformSoftplus},
+			},
+		},
+	}
+
+	schema := object{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "NeatConfig",
+		"type":    "object",
+		"properties": object{
+			"SpeciesConfig":    species,
+			"OrganismConfig":   organism,
+			"PopulationConfig": population,
+		},
+		"required": []string{"OrganismConfig"},
+	}
+
+	// Marshalling maps of strings, numbers and booleans cannot fail
+	b, _ := json.MarshalIndent(schema, "", "  ")
+	return string(b)
+}
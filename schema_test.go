@@ -0,0 +1,24 @@
+package neat
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeatConfigJSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(NeatConfigJSONSchema()), &schema), "")
+
+	properties := func(object interface{}) map[string]interface{} {
+		return object.(map[string]interface{})["properties"].(map[string]interface{})
+	}
+
+	organism := properties(schema)["OrganismConfig"]
+	actFunc := properties(organism)["ActFunc"].(map[string]interface{})
+	require.Contains(t, actFunc["enum"], "Sigmoid", "")
+
+	bound := properties(organism)["SynapseWeightBound"].(map[string]interface{})
+	require.Equal(t, 0.0, bound["exclusiveMinimum"], "")
+}
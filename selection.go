@@ -0,0 +1,171 @@
+package neat
+
+import (
+	"math"
+)
+
+// Is a fitter than b. Organisms with exactly the same fitness are ranked by
+// id, the lowest id wins, so that every choice of a fittest organism is
+// deterministic.
+func fitter(a, b *organism) bool {
+	if a.fitness != b.fitness {
+		return a.fitness > b.fitness
+	}
+
+	return a.id < b.id
+}
+
+// A strategy for picking an organism out of a population, e.g. when
+// choosing the parents of the next generation
+type SelectionStrategy interface {
+	// Select one organism from the population
+	Select(population []*organism) *organism
+}
+
+// Boltzmann (softmax) selection. An organism is selected with a probability
+// proportional to exp(fitness / T) where T is the temperature. A high
+// temperature approaches uniform selection (exploration) and a low
+// temperature approaches greedy selection (exploitation).
+type BoltzmannSelection struct {
+	// The selection temperature, a temperature of zero means greedy selection
+	Temperature float64
+
+	// The fraction by which the temperature is lowered on every call to
+	// Anneal, zero disables annealing
+	CoolingRate float64
+
+	// Annealing never lowers the temperature below this value
+	MinTemperature float64
+}
+
+// Create a Boltzmann selection strategy with a fixed temperature
+func NewBoltzmannSelection(temperature float64) *BoltzmannSelection {
+	return &BoltzmannSelection{Temperature: temperature}
+}
+
+func (s *BoltzmannSelection) Select(population []*organism) *organism {
+	if len(population) == 0 {
+		return nil
+	}
+
+	// Find the fittest organism, it is the greedy choice and its fitness is
+	// subtracted before exponentiating to keep exp from overflowing
+	best := population[0]
+	for _, org := range population[1:] {
+		if fitter(org, best) {
+			best = org
+		}
+	}
+
+	if s.Temperature <= 0 {
+		return best
+	}
+
+	weights := make([]float64, len(population))
+	total := 0.0
+	for i, org := range population {
+		weights[i] = math.Exp((org.fitness - best.fitness) / s.Temperature)
+		total += weights[i]
+	}
+
+	r := RandFloat64() * total
+	for i, w := range weights {
+		r -= w
+		if r < 0 {
+			return population[i]
+		}
+	}
+
+	return population[len(population)-1]
+}
+
+// Lower the temperature by the cooling rate, call once per generation to
+// gradually move from exploration to exploitation
+func (s *BoltzmannSelection) Anneal() {
+	s.Temperature = math.Max(s.MinTemperature, s.Temperature*(1-s.CoolingRate))
+}
+
+// Shift fitnesses so that they can be used as proportions. If any fitness
+// is negative the lowest one is mapped to a small positive value and the
+// others keep their distance to it, otherwise they are returned as they
+// are.
+func positiveFitness(fitness []float64) []float64 {
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, f := range fitness {
+		lowest = math.Min(lowest, f)
+		highest = math.Max(highest, f)
+	}
+
+	if len(fitness) == 0 || lowest >= 0 {
+		return fitness
+	}
+
+	// A hundredth of the spread, or of the magnitude if they're all equal
+	floor := 0.01 * (highest - lowest)
+	if floor == 0 {
+		floor = 0.01 * math.Abs(lowest)
+	}
+
+	shifted := make([]float64, len(fitness))
+	for i, f := range fitness {
+		shifted[i] = f - lowest + floor
+	}
+
+	return shifted
+}
+
+// Map a raw reward, e.g. a signed reward of an environment, to a positive
+// fitness with the configured FitnessTransform, softplus if none is
+// configured. Higher rewards map to higher fitnesses. Rewards out of the
+// range of the transform, e.g. below about -745, saturate at the smallest
+// positive or the largest finite fitness.
+func PositiveFitness(raw float64) float64 {
+	var fitness float64
+	if config.PopulationConfig.FitnessTransform == FitnessTransformExp {
+		fitness = math.Exp(raw)
+	} else {
+		// log(1 + exp(raw)) without overflowing for large rewards
+		fitness = math.Max(raw, 0) + math.Log1p(math.Exp(-math.Abs(raw)))
+	}
+
+	return math.Max(math.SmallestNonzeroFloat64, math.Min(math.MaxFloat64, fitness))
+}
+
+// Every organism is equally likely to be selected
+type uniformSelection struct{}
+
+func (uniformSelection) Select(population []*organism) *organism {
+	if len(population) == 0 {
+		return nil
+	}
+
+	return population[randIntn(len(population))]
+}
+
+// Tournament selection. A number of organisms are drawn at random and the
+// fittest of them is selected.
+type TournamentSelection struct {
+	// The number of organisms competing in each tournament
+	Size int
+}
+
+// Create a tournament selection strategy
+func NewTournamentSelection(size int) *TournamentSelection {
+	return &TournamentSelection{Size: size}
+}
+
+func (s *TournamentSelection) Select(population []*organism) *organism {
+	if len(population) == 0 {
+		return nil
+	}
+
+	var best *organism
+	for i := 0; i < max(1, s.Size); i++ {
+		org := population[randIntn(len(population))]
+		if best == nil || fitter(org, best) {
+			best = org
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,167 @@
+package neat
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Create a population with the given fitness values
+func createPopulation(fitness ...float64) []*organism {
+	population := make([]*organism, len(fitness))
+	for i, f := range fitness {
+		population[i] = newOrganism(1, 1)
+		population[i].fitness = f
+	}
+
+	return population
+}
+
+// Lowering the temperature should concentrate selection on the fittest
+// organism
+func TestBoltzmannSelection(t *testing.T) {
+	defer func(f func() float64) { RandFloat64 = f }(RandFloat64)
+	RandFloat64 = rand.New(rand.NewSource(1)).Float64
+
+	population := createPopulation(0, 1, 2, 3, 4)
+	best := population[4]
+
+	samples := 10000
+	prevShare := 0.0
+	for _, temperature := range []float64{100, 10, 1, 0.1} {
+		selection := NewBoltzmannSelection(temperature)
+
+		hits := 0
+		for i := 0; i < samples; i++ {
+			if selection.Select(population) == best {
+				hits++
+			}
+		}
+
+		share := float64(hits) / float64(samples)
+		t.Log("T: ", temperature, " best share: ", share)
+		require.True(t, share > prevShare, "")
+		prevShare = share
+	}
+
+	// At a very high temperature selection is close to uniform...
+	selection := NewBoltzmannSelection(1e6)
+	hits := 0
+	for i := 0; i < samples; i++ {
+		if selection.Select(population) == best {
+			hits++
+		}
+	}
+	require.InDelta(t, 0.2, float64(hits)/float64(samples), 0.02, "")
+
+	// ...and at a very low temperature it is greedy
+	require.True(t, prevShare > 0.99, "")
+}
+
+func TestBoltzmannAnneal(t *testing.T) {
+	selection := &BoltzmannSelection{
+		Temperature:    10,
+		CoolingRate:    0.5,
+		MinTemperature: 2,
+	}
+
+	selection.Anneal()
+	require.Equal(t, 5.0, selection.Temperature, "")
+
+	selection.Anneal()
+	selection.Anneal()
+	require.Equal(t, 2.0, selection.Temperature, "")
+}
+
+// Exact ties are broken in favour of the lowest id
+func TestSelectionTies(t *testing.T) {
+	withSeed(t, 1)
+
+	population := createPopulation(1, 1, 1)
+	// Give the last organism the lowest id
+	population[0].id, population[2].id = population[2].id, population[0].id
+	winner := population[2]
+
+	require.Equal(t, winner, NewBoltzmannSelection(0).Select(population), "")
+	require.Equal(t, winner, NewTournamentSelection(len(population)*10).Select(population), "")
+	require.Equal(t, winner, newPopulationFrom(1, 1, population).Champion(), "")
+}
+
+// Two runs with the same seed evolve the same genomes
+func TestSeededRunsAreReproducible(t *testing.T) {
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.actFunc = Sigmoid
+		c.OrganismConfig.SynapseSplitMutProb = 0.05
+		c.OrganismConfig.SynapseActivityMutProb = 0.05
+		c.OrganismConfig.SynapseWeightMutProb = 0.5
+		c.OrganismConfig.SynapseAddMutProb = 0.2
+		c.OrganismConfig.MaxNeurons = 20
+		c.OrganismConfig.MaxSynapses = 60
+		c.PopulationConfig.Size = 30
+	})
+
+	eval := func(org *organism) float64 {
+		fitness := 4.0
+		for _, x := range [][]float64{{0, 0, 1}, {0, 1, 1}, {1, 0, 1}, {1, 1, 1}} {
+			fitness -= math.Abs(org.process(x)[0] - float64(int(x[0])^int(x[1])))
+		}
+		return fitness
+	}
+
+	// The genes of every organism, ids and innovation numbers included
+	innovations, ids := innovationCount.Load(), idCount.Load()
+	run := func() []string {
+		innovationCount.Store(innovations)
+		idCount.Store(ids)
+		withSeed(t, 42)
+
+		population := NewPopulation(3, 1, PopulationOptions{})
+		for i := 0; i < 20; i++ {
+			population.Step(eval)
+		}
+
+		var genomes []string
+		for _, org := range population.organisms {
+			genome := fmt.Sprint(org.id, " ", org.fitness)
+			for _, g := range org.genes {
+				genome += fmt.Sprint(" ", g.getInnovation(), ":", describeGene(g))
+			}
+			genomes = append(genomes, genome)
+		}
+		return genomes
+	}
+
+	require.Equal(t, run(), run(), "")
+}
+
+func TestPositiveFitness(t *testing.T) {
+	raw := []float64{-1000, -50, -10, -1, -0.1, 0, 0.1, 1, 10, 50, 500, 1000}
+
+	for _, transform := range []string{"", FitnessTransformSoftplus, FitnessTransformExp} {
+		withConfig(t, func(c *NeatConfig) {
+			c.PopulationConfig.FitnessTransform = transform
+		})
+
+		previous := 0.0
+		for _, r := range raw {
+			fitness := PositiveFitness(r)
+			require.True(t, fitness > previous, "")
+			require.False(t, math.IsInf(fitness, 0), "")
+			previous = fitness
+		}
+	}
+
+	// The transform is applied before the fitnesses are used
+	withConfig(t, func(c *NeatConfig) {
+		c.PopulationConfig.Size = 10
+		c.PopulationConfig.FitnessTransform = FitnessTransformExp
+	})
+	population := NewPopulation(1, 1, PopulationOptions{})
+	population.Step(func(*organism) float64 { return -3 })
+	for _, org := range population.organisms {
+		require.Equal(t, math.Exp(-3), org.fitness, "")
+	}
+}
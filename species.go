@@ -0,0 +1,473 @@
+package neat
+
+import (
+	"math"
+	"sort"
+)
+
+// A species, a group of genetically similar organisms
+type Species struct {
+	// Unique id of the species
+	id uint64
+
+	// The number of generations the species has survived
+	age int
+
+	// The organisms of the species
+	population []*organism
+
+	// The organism that new organisms are compared against, picked by the
+	// configured representative strategy
+	rep *organism
+}
+
+func newSpecies(representative *organism) *Species {
+	s := &Species{id: nextID()}
+	s.add(representative)
+
+	return s
+}
+
+// Add an organism to the species
+func (s *Species) add(org *organism) {
+	org.species = s.id
+	s.population = append(s.population, org)
+
+	switch config.SpeciesConfig.RepresentativeStrategy {
+	case RepresentativeRandom:
+		// Reservoir sampling, every member is equally likely to be the
+		// representative
+		if s.rep == nil || randIntn(len(s.population)) == 0 {
+			s.rep = org
+		}
+	case RepresentativeChampion:
+		if s.rep == nil || fitter(org, s.rep) {
+			s.rep = org
+		}
+	default:
+		if s.rep == nil {
+			s.rep = org
+		}
+	}
+}
+
+// The organism that new organisms are compared against
+func (s *Species) representative() *organism {
+	return s.rep
+}
+
+// The number of organisms in the species
+func (s *Species) Size() int {
+	return len(s.population)
+}
+
+// The fittest member of the species, nil if it has no members
+func (s *Species) Champion() *organism {
+	var champion *organism
+	for _, org := range s.population {
+		if champion == nil || fitter(org, champion) {
+			champion = org
+		}
+	}
+
+	return champion
+}
+
+// The fitness of the fittest member, zero if it has no members
+func (s *Species) BestFitness() float64 {
+	if champion := s.Champion(); champion != nil {
+		return champion.fitness
+	}
+
+	return 0
+}
+
+// The mean fitness of the members, zero if it has no members
+func (s *Species) MeanFitness() float64 {
+	if len(s.population) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, org := range s.population {
+		sum += org.fitness
+	}
+
+	return sum / float64(len(s.population))
+}
+
+// The number of generations the species has survived
+func (s *Species) Age() int {
+	return s.age
+}
+
+// Divide organisms into species. The species of the previous generation
+// carry over, an organism joins the first species whose representative
+// is within the compatibility threshold, or founds a new species if there
+// is none. Species left without members die out and the surviving species
+// pick new representatives among their members.
+func speciate(previous []*Species, organisms []*organism) []*Species {
+	if k := config.SpeciesConfig.SpeciesCount; k > 0 {
+		return speciateNearest(previous, organisms, k)
+	}
+
+	// Organisms are classified against the representatives of the
+	// previous generation, the species start out empty
+	result := make([]*Species, len(previous))
+	reps := make([]*organism, len(previous))
+	sizes := make([]int, len(previous))
+	for i, s := range previous {
+		result[i] = &Species{id: s.id, age: s.age + 1}
+		reps[i] = s.representative()
+		sizes[i] = s.Size()
+	}
+
+	for _, org := range organisms {
+		found := -1
+		for i, rep := range reps {
+			d := compatibilityDistance(rep, org)
+			if d <= speciesThreshold(sizes[i]) {
+				found = i
+				break
+			}
+		}
+
+		if found != -1 {
+			result[found].add(org)
+			// Species founded in this generation grow as they go, the
+			// others keep the size they had in the previous one
+			if found >= len(previous) {
+				sizes[found]++
+			}
+		} else {
+			result = append(result, newSpecies(org))
+			reps = append(reps, org)
+			sizes = append(sizes, 1)
+		}
+	}
+
+	survivors := result[:0]
+	for _, s := range result {
+		if len(s.population) > 0 {
+			survivors = append(survivors, s)
+		}
+	}
+
+	return survivors
+}
+
+// The compatibility threshold of a species with the given size, see
+// PerSpeciesThreshold
+func speciesThreshold(size int) float64 {
+	c := config.SpeciesConfig
+	if !c.PerSpeciesThreshold || c.TargetSpeciesSize <= 0 || size <= 0 {
+		return c.CompatibilityThreshold
+	}
+
+	return c.CompatibilityThreshold * float64(c.TargetSpeciesSize) / float64(size)
+}
+
+// Divide a number of offspring between species in proportion to their
+// mean fitness. Every species gets the whole part of its share and the
+// offspring that are left go to the species with the largest fractional
+// parts. Negative mean fitnesses are shifted so that the lowest one gets a
+// small share, and the offspring are divided evenly if all mean fitnesses
+// are zero.
+func AllocateOffspring(species []*Species, totalOffspring int) []int {
+	allocation := make([]int, len(species))
+	if len(species) == 0 {
+		return allocation
+	}
+
+	shares := make([]float64, len(species))
+	for i, s := range species {
+		shares[i] = s.MeanFitness()
+	}
+	shares = positiveFitness(shares)
+
+	var total float64
+	for _, share := range shares {
+		total += share
+	}
+
+	for i := range shares {
+		if total > 0 {
+			shares[i] = shares[i] / total * float64(totalOffspring)
+		} else {
+			shares[i] = float64(totalOffspring) / float64(len(species))
+		}
+	}
+
+	remaining := totalOffspring
+	order := make([]int, len(species))
+	for i, share := range shares {
+		allocation[i] = int(math.Floor(share))
+		remaining -= allocation[i]
+		order[i] = i
+	}
+
+	// Largest fractional part first, ties go to the first species
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		return shares[a]-math.Floor(shares[a]) > shares[b]-math.Floor(shares[b])
+	})
+	for i := 0; i < remaining; i++ {
+		allocation[order[i%len(order)]]++
+	}
+
+	return allocation
+}
+
+// The mean Euclidean distance between the outputs of two organisms over
+// a batch of inputs, a measure of how differently they behave regardless
+// of their genomes
+func BehavioralDistance(a, b *organism, inputs [][]float64) float64 {
+	return outputDistance(a.ProcessBatch(inputs), b.ProcessBatch(inputs))
+}
+
+// The mean Euclidean distance between two batches of outputs, zero for
+// empty batches
+func outputDistance(a, b [][]float64) float64 {
+	if len(a) == 0 {
+		return 0
+	}
+
+	var total float64
+	for i := range a {
+		var sum float64
+		for j := range a[i] {
+			d := a[i][j] - b[i][j]
+			sum += d * d
+		}
+		total += math.Sqrt(sum)
+	}
+
+	return total / float64(len(a))
+}
+
+// Divide organisms into species by behavior rather than genome. An
+// organism joins the first species whose representative is within the
+// threshold in BehavioralDistance over the inputs, or founds a new species
+// if there is none.
+func AssignSpeciesByBehavior(organisms []*organism, inputs [][]float64, threshold float64) []*Species {
+	// Every organism only needs to be run once
+	outputs := make(map[*organism][][]float64, len(organisms))
+	for _, org := range organisms {
+		outputs[org] = org.ProcessBatch(inputs)
+	}
+
+	var result []*Species
+	for _, org := range organisms {
+		var found *Species
+		for _, s := range result {
+			if outputDistance(outputs[s.representative()], outputs[org]) <= threshold {
+				found = s
+				break
+			}
+		}
+
+		if found != nil {
+			found.add(org)
+		} else {
+			result = append(result, newSpecies(org))
+		}
+	}
+
+	return result
+}
+
+// The maximum number of times the representatives are refined when
+// speciating into a fixed number of species
+const nearestSpeciationRounds = 10
+
+// Divide organisms into k species, k-means style. The representatives are
+// seeded with k-means++ in compatibility space and then refined by
+// repeatedly assigning every organism to its nearest representative and
+// making the most central member of each group its new representative.
+// Like speciate the species of the previous generation live on, see
+// continueSpecies.
+func speciateNearest(previous []*Species, organisms []*organism, k int) []*Species {
+	if len(organisms) == 0 {
+		return nil
+	}
+
+	reps := seedRepresentatives(organisms, min(k, len(organisms)))
+
+	var groups [][]*organism
+	for round := 0; round < nearestSpeciationRounds; round++ {
+		groups = assignNearest(organisms, reps)
+
+		changed := false
+		for i, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+
+			if m := medoid(group); m != reps[i] {
+				reps[i] = m
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+	}
+
+	var result []*Species
+	for i, group := range groups {
+		// Two identical representatives leave the second one without
+		// members
+		if len(group) == 0 {
+			continue
+		}
+
+		s := newSpecies(reps[i])
+		for _, org := range group {
+			if org != reps[i] {
+				s.add(org)
+			}
+		}
+		result = append(result, s)
+	}
+	continueSpecies(previous, result)
+
+	return result
+}
+
+// Let the new species continue the previous species with the nearest
+// representatives, so that they keep their ids and grow older. The nearest
+// pairs are matched first and every previous species is continued at most
+// once, new species without a match keep their new ids.
+func continueSpecies(previous, current []*Species) {
+	type match struct {
+		current, previous int
+		distance          float64
+	}
+
+	var matches []match
+	for i, s := range current {
+		for j, p := range previous {
+			d := compatibilityDistance(p.representative(), s.representative())
+			matches = append(matches, match{i, j, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	continued := make([]bool, len(current))
+	taken := make([]bool, len(previous))
+	for _, m := range matches {
+		if continued[m.current] || taken[m.previous] {
+			continue
+		}
+		continued[m.current], taken[m.previous] = true, true
+
+		s, p := current[m.current], previous[m.previous]
+		s.id, s.age = p.id, p.age+1
+		for _, org := range s.population {
+			org.species = s.id
+		}
+	}
+}
+
+// Pick k distinct representatives using k-means++ seeding, every
+// organism is picked with a probability proportional to the squared
+// distance to its nearest already picked representative
+func seedRepresentatives(organisms []*organism, k int) []*organism {
+	reps := []*organism{organisms[randIntn(len(organisms))]}
+
+	nearest := make([]float64, len(organisms))
+	for i, org := range organisms {
+		nearest[i] = CompatibilityDistance(reps[0], org, config.SpeciesConfig)
+	}
+
+	for len(reps) < k {
+		var total float64
+		for _, d := range nearest {
+			total += d * d
+		}
+
+		next := -1
+		if total > 0 {
+			r := RandFloat64() * total
+			for i, d := range nearest {
+				r -= d * d
+				if d > 0 && r < 0 {
+					next = i
+					break
+				}
+			}
+		}
+
+		// Every organism is identical to a representative, fall back to
+		// picking one that hasn't been picked
+		if next == -1 {
+			for i, org := range organisms {
+				if !containsOrganism(reps, org) {
+					next = i
+					break
+				}
+			}
+		}
+
+		rep := organisms[next]
+		reps = append(reps, rep)
+		for i, org := range organisms {
+			nearest[i] = math.Min(nearest[i], CompatibilityDistance(rep, org, config.SpeciesConfig))
+		}
+	}
+
+	return reps
+}
+
+// Group organisms by their nearest representative, ties go to the first
+// representative
+func assignNearest(organisms, reps []*organism) [][]*organism {
+	groups := make([][]*organism, len(reps))
+
+	for _, org := range organisms {
+		best := 0
+		bestDist := math.Inf(1)
+		for i, rep := range reps {
+			if d := CompatibilityDistance(rep, org, config.SpeciesConfig); d < bestDist {
+				best = i
+				bestDist = d
+			}
+		}
+		groups[best] = append(groups[best], org)
+	}
+
+	return groups
+}
+
+// The member with the smallest total distance to the other members
+func medoid(group []*organism) *organism {
+	best := group[0]
+	bestSum := math.Inf(1)
+
+	for _, a := range group {
+		var sum float64
+		for _, b := range group {
+			sum += CompatibilityDistance(a, b, config.SpeciesConfig)
+		}
+
+		if sum < bestSum {
+			best = a
+			bestSum = sum
+		}
+	}
+
+	return best
+}
+
+func containsOrganism(organisms []*organism, org *organism) bool {
+	for _, o := range organisms {
+		if o == org {
+			return true
+		}
+	}
+
+	return false
+}
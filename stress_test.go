@@ -0,0 +1,54 @@
+//go:build slow
+
+package neat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Evolve a large population with a random fitness function and concurrent
+// evaluation, run with -race to check that the evaluation workers don't
+// share any state
+func TestLargePopulation(t *testing.T) {
+	// Offspring inherit the genes of both parents, with a random fitness
+	// nothing keeps the genomes from growing without bound once neurons
+	// are added. The size caps limit the growth.
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0.03
+		c.OrganismConfig.MaxNeurons = 30
+		c.OrganismConfig.MaxSynapses = 100
+		c.OrganismConfig.SynapseActivityMutProb = 0.01
+		c.OrganismConfig.SynapseWeightMutProb = 0.2
+		c.OrganismConfig.SynapseAddMutProb = 0.02
+		c.OrganismConfig.MaxConnectionDensity = 0.5
+		c.OrganismConfig.actFunc = Sigmoid
+		c.PopulationConfig.Size = 500
+	})
+
+	// RandFloat64 is rand.Float64 which is safe for concurrent use, the
+	// network is run so that the workers process their organisms
+	eval := func(org *organism) float64 {
+		out := org.processFeedforward([]float64{
+			RandFloat64(), RandFloat64(), RandFloat64(), RandFloat64(), RandFloat64(),
+		})
+		return RandFloat64() * out[0]
+	}
+
+	population := NewPopulation(5, 3, PopulationOptions{Workers: 4})
+	for i := 0; i < 100; i++ {
+		population.Step(eval)
+	}
+
+	require.Equal(t, 100, population.Generation(), "")
+	require.Equal(t, 500, len(population.organisms), "")
+	require.True(t, population.Champion().fitness > 0, "")
+
+	// The topologies grew
+	grown := false
+	for _, org := range population.organisms {
+		grown = grown || len(org.neurons) > 5+3
+	}
+	require.True(t, grown, "")
+}
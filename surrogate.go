@@ -0,0 +1,243 @@
+package neat
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// A surrogate model of the fitness function, Gaussian process regression
+// with an RBF kernel over the synapse weights, for fitness functions that
+// are expensive to evaluate. An organism is represented by the weights of
+// its enabled synapses by innovation number, a missing synapse has a weight
+// of zero.
+type GPSurrogate struct {
+	// The length scale of the RBF kernel, the distance between weight
+	// vectors over which the fitness is correlated
+	LengthScale float64
+
+	// The variance of the noise on the evaluated fitnesses, a small value
+	// makes the surrogate reproduce the evaluations it was trained on
+	Noise float64
+
+	// The number of evaluations remembered, the oldest ones are forgotten
+	// first. Zero remembers every evaluation.
+	MaxPoints int
+
+	points  []map[uint64]float64
+	fitness []float64
+
+	// The prior mean, the mean fitness, and the weights of the training
+	// points in a prediction. alpha is nil when it has to be recomputed.
+	mean  float64
+	alpha []float64
+}
+
+// Create a surrogate with the given kernel length scale and noise variance
+// that remembers at most maxPoints evaluations, zero meaning all of them
+func NewGPSurrogate(lengthScale, noise float64, maxPoints int) *GPSurrogate {
+	return &GPSurrogate{LengthScale: lengthScale, Noise: noise, MaxPoints: maxPoints}
+}
+
+// The number of evaluations the surrogate is trained on
+func (gp *GPSurrogate) Size() int {
+	return len(gp.points)
+}
+
+// Train the surrogate on an evaluation of an organism
+func (gp *GPSurrogate) Update(org *organism, fitness float64) {
+	gp.points = append(gp.points, weightVector(org))
+	gp.fitness = append(gp.fitness, fitness)
+
+	if gp.MaxPoints > 0 && len(gp.points) > gp.MaxPoints {
+		drop := len(gp.points) - gp.MaxPoints
+		gp.points = gp.points[drop:]
+		gp.fitness = gp.fitness[drop:]
+	}
+
+	gp.alpha = nil
+}
+
+// The predicted fitness of an organism, the posterior mean. Zero if the
+// surrogate hasn't been trained.
+func (gp *GPSurrogate) PredictFitness(org *organism) float64 {
+	if len(gp.points) == 0 {
+		return 0
+	}
+	gp.fit()
+
+	x := weightVector(org)
+	prediction := gp.mean
+	for i, p := range gp.points {
+		prediction += gp.alpha[i] * gp.kernel(p, x)
+	}
+
+	return prediction
+}
+
+// Solve (K + Noise I) alpha = fitness - mean for the training points
+func (gp *GPSurrogate) fit() {
+	if gp.alpha != nil || len(gp.points) == 0 {
+		return
+	}
+
+	n := len(gp.points)
+	gp.mean = 0
+	for _, f := range gp.fitness {
+		gp.mean += f
+	}
+	gp.mean /= float64(n)
+
+	k := make([][]float64, n)
+	y := make([]float64, n)
+	for i := range k {
+		k[i] = make([]float64, n)
+		for j := 0; j <= i; j++ {
+			k[i][j] = gp.kernel(gp.points[i], gp.points[j])
+			k[j][i] = k[i][j]
+		}
+		// A tiny jitter keeps the matrix positive definite when the same
+		// weights have been evaluated twice
+		k[i][i] += gp.Noise + 1e-10
+		y[i] = gp.fitness[i] - gp.mean
+	}
+
+	gp.alpha = choleskySolve(k, y)
+}
+
+// The RBF kernel, exp(-|a - b|^2 / (2 LengthScale^2))
+func (gp *GPSurrogate) kernel(a, b map[uint64]float64) float64 {
+	var d2 float64
+	for innovation, w := range a {
+		d := w - b[innovation]
+		d2 += d * d
+	}
+	for innovation, w := range b {
+		if _, ok := a[innovation]; !ok {
+			d2 += w * w
+		}
+	}
+
+	return math.Exp(-d2 / (2 * gp.LengthScale * gp.LengthScale))
+}
+
+// The weights of the enabled synapses by innovation number
+func weightVector(org *organism) map[uint64]float64 {
+	weights := make(map[uint64]float64)
+	for _, s := range org.synapses {
+		if s.enabled {
+			weights[s.innovation] = s.weight
+		}
+	}
+
+	return weights
+}
+
+// Solve a x = b for a symmetric positive definite matrix a using the
+// Cholesky decomposition a = l l^T, a is overwritten
+func choleskySolve(a [][]float64, b []float64) []float64 {
+	n := len(a)
+
+	// Decompose in place, l is stored in the lower triangle
+	for j := 0; j < n; j++ {
+		sum := a[j][j]
+		for k := 0; k < j; k++ {
+			sum -= a[j][k] * a[j][k]
+		}
+		a[j][j] = math.Sqrt(math.Max(sum, 1e-12))
+
+		for i := j + 1; i < n; i++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= a[i][k] * a[j][k]
+			}
+			a[i][j] = sum / a[j][j]
+		}
+	}
+
+	// Forward substitution l y = b
+	x := make([]float64, n)
+	for i := 0; i < n; i++ {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= a[i][k] * x[k]
+		}
+		x[i] = sum / a[i][i]
+	}
+
+	// Back substitution l^T x = y
+	for i := n - 1; i >= 0; i-- {
+		sum := x[i]
+		for k := i + 1; k < n; k++ {
+			sum -= a[k][i] * x[k]
+		}
+		x[i] = sum / a[i][i]
+	}
+
+	return x
+}
+
+// Evolve the population one generation like Step, evaluating only the more
+// complex half of the offspring with the fitness function and predicting
+// the fitness of the others with the surrogate. Organisms evaluated apart
+// from the offspring, e.g. injected random organisms, are always
+// evaluated. The surrogate is trained on the evaluations once the step is
+// done, until it has been trained every organism is evaluated.
+func (p *Population) StepSurrogate(eval FitnessFunction, gp *GPSurrogate) {
+	var predicted map[*organism]bool
+	p.beforeEvaluate = func(offspring []*organism) {
+		predicted = simplerHalf(offspring)
+	}
+	defer func() { p.beforeEvaluate = nil }()
+
+	// Fit before stepping so that predictions don't change the surrogate
+	// while the organisms are being evaluated, possibly concurrently
+	trained := gp.Size() > 0
+	gp.fit()
+
+	type evaluation struct {
+		org     *organism
+		fitness float64
+	}
+	var mu sync.Mutex
+	var evaluations []evaluation
+
+	p.Step(func(org *organism) float64 {
+		if trained && predicted[org] {
+			return gp.PredictFitness(org)
+		}
+
+		fitness := eval(org)
+		mu.Lock()
+		evaluations = append(evaluations, evaluation{org, fitness})
+		mu.Unlock()
+
+		return fitness
+	})
+
+	for _, e := range evaluations {
+		gp.Update(e.org, e.fitness)
+	}
+}
+
+// The least complex half of the organisms, rounded down so that at least
+// half of them are left. Organisms of the same complexity are ordered by
+// id, so that ties don't move more than half of the organisms to one side.
+func simplerHalf(organisms []*organism) map[*organism]bool {
+	sorted := make([]*organism, len(organisms))
+	copy(sorted, organisms)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Complexity(), sorted[j].Complexity()
+		if a != b {
+			return a < b
+		}
+		return sorted[i].id < sorted[j].id
+	})
+
+	half := make(map[*organism]bool, len(sorted)/2)
+	for _, org := range sorted[:len(sorted)/2] {
+		half[org] = true
+	}
+
+	return half
+}
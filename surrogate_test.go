@@ -0,0 +1,133 @@
+package neat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPSurrogate(t *testing.T) {
+	withSeed(t, 1)
+
+	gp := NewGPSurrogate(2, 1e-8, 0)
+	require.Equal(t, 0.0, gp.PredictFitness(newOrganism(2, 1)), "")
+
+	// The fitness is the sum of the weights
+	base := newOrganism(2, 1)
+	var organisms []*organism
+	for i := 0; i < 10; i++ {
+		org := base.clone()
+		var fitness float64
+		for _, s := range org.synapses {
+			s.mutateWeight(config.OrganismConfig.SynapseWeightBound)
+			fitness += s.weight
+		}
+		org.fitness = fitness
+
+		organisms = append(organisms, org)
+		gp.Update(org, fitness)
+	}
+	require.Equal(t, 10, gp.Size(), "")
+
+	// The training points are predicted correctly
+	for _, org := range organisms {
+		require.InDelta(t, org.fitness, gp.PredictFitness(org), 1e-3, "")
+	}
+
+	// Far from the training points the prediction is the mean fitness
+	far := base.clone()
+	for _, s := range far.synapses {
+		s.weight = 1000
+	}
+	var mean float64
+	for _, org := range organisms {
+		mean += org.fitness / 10
+	}
+	require.InDelta(t, mean, gp.PredictFitness(far), 1e-6, "")
+
+	// Only the latest evaluations are remembered
+	gp.MaxPoints = 5
+	gp.Update(organisms[0], organisms[0].fitness)
+	require.Equal(t, 5, gp.Size(), "")
+}
+
+func TestStepSurrogate(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0.05
+		c.OrganismConfig.SynapseAddMutProb = 0.1
+		c.OrganismConfig.SynapseWeightMutProb = 0.5
+		c.PopulationConfig.Size = 20
+
+		// A single species, so that every organism of the next generation
+		// is an offspring
+		c.SpeciesConfig.CompatibilityThreshold = 1000
+	})
+
+	evaluated := make(map[*organism]bool)
+	eval := func(org *organism) float64 {
+		evaluated[org] = true
+		return org.processFeedforward([]float64{1, 1})[0]
+	}
+
+	gp := NewGPSurrogate(1, 1e-6, 100)
+	population := NewPopulation(2, 1, PopulationOptions{})
+
+	// Without training every organism is evaluated
+	population.StepSurrogate(eval, gp)
+	require.Equal(t, 40, len(evaluated), "")
+	require.Equal(t, 40, gp.Size(), "")
+
+	// From then on only the more complex half of the offspring is, and the
+	// surrogate learns from them
+	for i := 0; i < 5; i++ {
+		evaluated = make(map[*organism]bool)
+		size := gp.Size()
+		population.StepSurrogate(eval, gp)
+
+		require.Equal(t, 10, len(evaluated), "")
+		require.Equal(t, min(100, size+10), gp.Size(), "")
+		for org := range evaluated {
+			for _, other := range population.organisms {
+				if !evaluated[other] {
+					require.True(t, org.Complexity() >= other.Complexity(), "")
+				}
+			}
+		}
+	}
+}
+
+func TestStepSurrogateEqualComplexity(t *testing.T) {
+	withSeed(t, 1)
+	withConfig(t, func(c *NeatConfig) {
+		c.OrganismConfig.SynapseSplitMutProb = 0
+		c.OrganismConfig.SynapseActivityMutProb = 0
+		c.OrganismConfig.SynapseAddMutProb = 0
+		c.OrganismConfig.SynapseWeightMutProb = 0.5
+		c.PopulationConfig.Size = 20
+		c.SpeciesConfig.CompatibilityThreshold = 1000
+	})
+
+	evaluations := 0
+	eval := func(org *organism) float64 {
+		evaluations++
+		return org.processFeedforward([]float64{1, 1})[0]
+	}
+
+	gp := NewGPSurrogate(1, 1e-6, 100)
+	population := NewPopulation(2, 1, PopulationOptions{})
+	population.StepSurrogate(eval, gp)
+
+	// The offspring all have the same complexity, still half of them are
+	// evaluated
+	for i := 0; i < 3; i++ {
+		evaluations = 0
+		population.StepSurrogate(eval, gp)
+
+		complexity := population.organisms[0].Complexity()
+		for _, org := range population.organisms {
+			require.Equal(t, complexity, org.Complexity(), "")
+		}
+		require.Equal(t, 10, evaluations, "")
+	}
+}
@@ -0,0 +1,816 @@
+package neat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// Find the enabled synapses that close a cycle, i.e. the recurrent
+// synapses, by a depth first search starting at the sensors and then at
+// any neurons not reachable from the sensors
+func (org *organism) recurrentSynapses() map[synapseID]bool {
+	recurrent := make(map[synapseID]bool)
+
+	// Neurons that have been fully explored
+	done := make(map[neuronID]bool)
+	// Neurons on the current search path
+	active := make(map[neuronID]bool)
+
+	var visit func(id neuronID)
+	visit = func(id neuronID) {
+		active[id] = true
+
+		for _, sid := range org.connections[id] {
+			s := org.synapses[sid]
+			if !s.enabled {
+				continue
+			}
+
+			if active[s.out] {
+				recurrent[sid] = true
+			} else if !done[s.out] {
+				visit(s.out)
+			}
+		}
+
+		active[id] = false
+		done[id] = true
+	}
+
+	for _, id := range org.sensors {
+		if !done[id] {
+			visit(id)
+		}
+	}
+
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok && !done[n.id] {
+			visit(n.id)
+		}
+	}
+
+	return recurrent
+}
+
+// The depth of the network, the number of synapses on the longest
+// feedforward path from a sensor. Recurrent synapses are not counted.
+func (org *organism) depth() int {
+	recurrent := org.recurrentSynapses()
+
+	// The longest path starting at each neuron
+	longest := make(map[neuronID]int)
+
+	var visit func(id neuronID) int
+	visit = func(id neuronID) int {
+		if d, ok := longest[id]; ok {
+			return d
+		}
+
+		d := 0
+		for _, sid := range org.connections[id] {
+			s := org.synapses[sid]
+			if s.enabled && !recurrent[sid] {
+				d = max(d, visit(s.out)+1)
+			}
+		}
+
+		longest[id] = d
+		return d
+	}
+
+	depth := 0
+	for _, id := range org.sensors {
+		depth = max(depth, visit(id))
+	}
+
+	return depth
+}
+
+// Assign the neurons of a feedforward network to layers. The sensors make
+// up the first layer, the outputs the last layer and every hidden neuron
+// is placed in the layer after its deepest predecessor. Neurons are in gene
+// order within a layer. Recurrent synapses are ignored.
+func (org *organism) layers() [][]neuronID {
+	recurrent := org.recurrentSynapses()
+
+	// The enabled feedforward synapses into each neuron
+	incoming := make(map[neuronID][]*synapse)
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && s.enabled && !recurrent[s.id] {
+			incoming[s.out] = append(incoming[s.out], s)
+		}
+	}
+
+	layer := make(map[neuronID]int)
+
+	var visit func(n *neuron) int
+	visit = func(n *neuron) int {
+		if l, ok := layer[n.id]; ok {
+			return l
+		}
+
+		l := 0
+		if n.kind != sensorNeuron {
+			l = 1
+			for _, s := range incoming[n.id] {
+				l = max(l, visit(org.neurons[s.in])+1)
+			}
+		}
+
+		layer[n.id] = l
+		return l
+	}
+
+	// Outputs go in the last layer
+	last := 1
+	for _, n := range org.neurons {
+		if n.kind != outputNeuron {
+			last = max(last, visit(n)+1)
+		}
+	}
+
+	result := make([][]neuronID, last+1)
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok {
+			l := last
+			if n.kind != outputNeuron {
+				l = layer[n.id]
+			}
+			result[l] = append(result[l], n.id)
+		}
+	}
+
+	// Drop layers left empty, e.g. when there are no hidden neurons
+	layers := result[:0]
+	for _, l := range result {
+		if len(l) > 0 {
+			layers = append(layers, l)
+		}
+	}
+
+	return layers
+}
+
+// A dense matrix of synapse weights stored in row-major order, ready for
+// gonum's mat.NewDense(m.Rows, m.Cols, m.Data). Rows are the receiving
+// neurons and columns the sending neurons.
+type WeightMatrix struct {
+	Rows int
+	Cols int
+	Data []float64
+	// The receiving neuron of each row
+	RowNeurons []neuronID
+	// The sending neuron of each column
+	ColNeurons []neuronID
+}
+
+func newWeightMatrix(rows, cols []neuronID) WeightMatrix {
+	return WeightMatrix{
+		Rows:       len(rows),
+		Cols:       len(cols),
+		Data:       make([]float64, len(rows)*len(cols)),
+		RowNeurons: rows,
+		ColNeurons: cols,
+	}
+}
+
+// The weight matrices of the network. A feedforward network has one matrix
+// per layer after the first, mapping the neurons of all preceding layers,
+// in layer order, to the neurons of the layer so that synapses skipping
+// layers are kept. Any other network is returned as a single adjacency
+// matrix over all neurons in gene order. Disabled synapses have weight 0.
+func (org *organism) WeightMatrices() []WeightMatrix {
+	layers := org.layers()
+
+	layerOf := make(map[neuronID]int)
+	for l, ids := range layers {
+		for _, id := range ids {
+			layerOf[id] = l
+		}
+	}
+
+	feedforward := true
+	for _, s := range org.synapses {
+		if s.enabled && layerOf[s.in] >= layerOf[s.out] {
+			feedforward = false
+			break
+		}
+	}
+
+	if !feedforward {
+		var ids []neuronID
+		for _, g := range org.genes {
+			if n, ok := g.(*neuron); ok {
+				ids = append(ids, n.id)
+			}
+		}
+
+		m := newWeightMatrix(ids, ids)
+		m.fill(org)
+		return []WeightMatrix{m}
+	}
+
+	var matrices []WeightMatrix
+	var cols []neuronID
+	for l := 1; l < len(layers); l++ {
+		cols = append(cols, layers[l-1]...)
+
+		// Copy the columns so that the matrices don't share storage
+		m := newWeightMatrix(layers[l], append([]neuronID(nil), cols...))
+		m.fill(org)
+		matrices = append(matrices, m)
+	}
+
+	return matrices
+}
+
+// Fill in the weights of the enabled synapses between the row and column
+// neurons of the matrix
+func (m *WeightMatrix) fill(org *organism) {
+	row := make(map[neuronID]int)
+	for i, id := range m.RowNeurons {
+		row[id] = i
+	}
+
+	for j, id := range m.ColNeurons {
+		for _, sid := range org.connections[id] {
+			s := org.synapses[sid]
+			if i, ok := row[s.out]; ok && s.enabled {
+				m.Data[i*m.Cols+j] = s.weight
+			}
+		}
+	}
+}
+
+// The enabled synapse weights of an organism by sending and receiving
+// neuron. The weights of parallel synapses are summed.
+type weightGraph map[neuronID]map[neuronID]float64
+
+func newWeightGraph(org *organism) weightGraph {
+	g := make(weightGraph)
+	for _, s := range org.synapses {
+		if !s.enabled {
+			continue
+		}
+		if g[s.in] == nil {
+			g[s.in] = make(map[neuronID]float64)
+		}
+		g[s.in][s.out] += s.weight
+	}
+
+	return g
+}
+
+// Check whether two organisms compute the same network, i.e. whether there
+// is a mapping between their neurons that preserves the neuron kinds, the
+// order of the sensors and outputs and the enabled synapse weights. Neuron
+// and synapse ids and innovation numbers are ignored.
+func IsomorphicOrganisms(a, b *organism) bool {
+	if len(a.sensors) != len(b.sensors) ||
+		len(a.outputs) != len(b.outputs) ||
+		len(a.neurons) != len(b.neurons) {
+		return false
+	}
+
+	ga, gb := newWeightGraph(a), newWeightGraph(b)
+	if len(ga) != len(gb) {
+		return false
+	}
+
+	// Label the neurons of both organisms with a shared labeling so that
+	// only neurons with the same label can be mapped onto each other
+	labelsA, labelsB := canonicalLabels(a, ga, b, gb)
+
+	// Candidate neurons of b by label
+	candidates := make(map[int][]neuronID)
+	for _, g := range b.genes {
+		if n, ok := g.(*neuron); ok {
+			candidates[labelsB[n.id]] = append(candidates[labelsB[n.id]], n.id)
+		}
+	}
+
+	var order []neuronID
+	for _, g := range a.genes {
+		if n, ok := g.(*neuron); ok {
+			order = append(order, n.id)
+			if len(candidates[labelsA[n.id]]) == 0 {
+				return false
+			}
+		}
+	}
+
+	mapping := make(map[neuronID]neuronID)
+	used := make(map[neuronID]bool)
+
+	// Check the synapses between id and the already mapped neurons
+	consistent := func(id neuronID) bool {
+		for other, otherB := range mapping {
+			wa, okA := ga[id][other]
+			wb, okB := gb[mapping[id]][otherB]
+			if okA != okB || wa != wb {
+				return false
+			}
+			wa, okA = ga[other][id]
+			wb, okB = gb[otherB][mapping[id]]
+			if okA != okB || wa != wb {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var match func(i int) bool
+	match = func(i int) bool {
+		if i == len(order) {
+			return true
+		}
+
+		id := order[i]
+		for _, c := range candidates[labelsA[id]] {
+			if used[c] {
+				continue
+			}
+
+			mapping[id] = c
+			used[c] = true
+			if consistent(id) && match(i+1) {
+				return true
+			}
+			delete(mapping, id)
+			used[c] = false
+		}
+
+		return false
+	}
+
+	return match(0)
+}
+
+// Label the neurons of two organisms by iteratively refining an initial
+// labeling based on the neuron kind, the sensor or output index and the
+// degree with the labels and weights of the neighbouring neurons. Neurons
+// that can be mapped onto each other always end up with the same label.
+func canonicalLabels(a *organism, ga weightGraph, b *organism, gb weightGraph) (map[neuronID]int, map[neuronID]int) {
+	// Labels are shared between the organisms through the signatures
+	ids := make(map[string]int)
+	label := func(signature string) int {
+		if id, ok := ids[signature]; ok {
+			return id
+		}
+		ids[signature] = len(ids)
+		return ids[signature]
+	}
+
+	initial := func(org *organism, g weightGraph) map[neuronID]int {
+		index := make(map[neuronID]int)
+		for i, id := range org.sensors {
+			index[id] = i
+		}
+		for i, id := range org.outputs {
+			index[id] = i
+		}
+
+		inDegree := make(map[neuronID]int)
+		for _, out := range g {
+			for id := range out {
+				inDegree[id]++
+			}
+		}
+
+		labels := make(map[neuronID]int)
+		for id, n := range org.neurons {
+			labels[id] = label(fmt.Sprint(n.kind, index[id], inDegree[id], len(g[id])))
+		}
+
+		return labels
+	}
+
+	refine := func(org *organism, g weightGraph, labels map[neuronID]int) map[neuronID]int {
+		in := make(map[neuronID][]string)
+		out := make(map[neuronID][]string)
+		for from, to := range g {
+			for id, w := range to {
+				out[from] = append(out[from], fmt.Sprint(labels[id], w))
+				in[id] = append(in[id], fmt.Sprint(labels[from], w))
+			}
+		}
+
+		refined := make(map[neuronID]int)
+		for id := range org.neurons {
+			sort.Strings(in[id])
+			sort.Strings(out[id])
+			refined[id] = label(fmt.Sprint(labels[id], in[id], out[id]))
+		}
+
+		return refined
+	}
+
+	labelsA, labelsB := initial(a, ga), initial(b, gb)
+	// The labeling is stable after at most one round per neuron
+	for i := 0; i < len(a.neurons); i++ {
+		nextA, nextB := refine(a, ga, labelsA), refine(b, gb, labelsB)
+		stable := countLabels(nextA)+countLabels(nextB) == countLabels(labelsA)+countLabels(labelsB)
+		labelsA, labelsB = nextA, nextB
+		if stable {
+			break
+		}
+	}
+
+	return labelsA, labelsB
+}
+
+// The number of distinct labels
+func countLabels(labels map[neuronID]int) int {
+	distinct := make(map[int]bool)
+	for _, l := range labels {
+		distinct[l] = true
+	}
+
+	return len(distinct)
+}
+
+// A hash of the structure of the network, the innovation numbers of the
+// neurons and the enabled synapses. Organisms that only differ in their
+// weights have the same hash.
+func (org *organism) topologyHash() uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, g := range org.genes {
+		if s, ok := g.(*synapse); ok && !s.enabled {
+			continue
+		}
+
+		binary.LittleEndian.PutUint64(buf, g.getInnovation())
+		h.Write(buf)
+	}
+
+	return h.Sum64()
+}
+
+// A hash of the structure of the network that doesn't depend on the ids and
+// innovation numbers of its genes, i.e. on the order in which the network
+// was built. Only the neuron kinds, the order of the sensors and outputs and
+// the enabled synapses count, organisms that only differ in their weights
+// have the same hash.
+func (org *organism) StructuralHash() uint64 {
+	labels := org.structuralLabels()
+
+	var neurons []uint64
+	for _, l := range labels {
+		neurons = append(neurons, l)
+	}
+
+	var synapses [][2]uint64
+	for _, s := range org.synapses {
+		if s.enabled {
+			synapses = append(synapses, [2]uint64{labels[s.in], labels[s.out]})
+		}
+	}
+
+	sort.Slice(neurons, func(i, j int) bool { return neurons[i] < neurons[j] })
+	sort.Slice(synapses, func(i, j int) bool {
+		if synapses[i][0] != synapses[j][0] {
+			return synapses[i][0] < synapses[j][0]
+		}
+		return synapses[i][1] < synapses[j][1]
+	})
+
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	write := func(x uint64) {
+		binary.LittleEndian.PutUint64(buf, x)
+		h.Write(buf)
+	}
+
+	write(uint64(len(neurons)))
+	for _, l := range neurons {
+		write(l)
+	}
+	for _, s := range synapses {
+		write(s[0])
+		write(s[1])
+	}
+
+	return h.Sum64()
+}
+
+// Label the neurons by their position in the network rather than by id.
+// The initial label is based on the neuron kind, the sensor or output index
+// and the layer, the length of the shortest path from a sensor, and is then
+// refined with the labels of the neighbouring neurons like in
+// canonicalLabels. Labels are hashes so that they don't depend on the order
+// in which the neurons are labeled.
+func (org *organism) structuralLabels() map[neuronID]uint64 {
+	label := func(signature string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(signature))
+		return h.Sum64()
+	}
+
+	var enabled []*synapse
+	for _, s := range org.synapses {
+		if s.enabled {
+			enabled = append(enabled, s)
+		}
+	}
+
+	index := make(map[neuronID]int)
+	for i, id := range org.sensors {
+		index[id] = i
+	}
+	for i, id := range org.outputs {
+		index[id] = i
+	}
+
+	// Breadth first from all sensors, unreachable neurons have layer -1
+	layer := make(map[neuronID]int)
+	queue := append([]neuronID(nil), org.sensors...)
+	for _, id := range org.sensors {
+		layer[id] = 0
+	}
+	for i := 0; i < len(queue); i++ {
+		for _, sid := range org.connections[queue[i]] {
+			s := org.synapses[sid]
+			if _, ok := layer[s.out]; s.enabled && !ok {
+				layer[s.out] = layer[queue[i]] + 1
+				queue = append(queue, s.out)
+			}
+		}
+	}
+
+	labels := make(map[neuronID]uint64)
+	for id, n := range org.neurons {
+		l, ok := layer[id]
+		if !ok {
+			l = -1
+		}
+		labels[id] = label(fmt.Sprint(n.kind, index[id], l))
+	}
+
+	distinct := func(labels map[neuronID]uint64) int {
+		seen := make(map[uint64]bool)
+		for _, l := range labels {
+			seen[l] = true
+		}
+		return len(seen)
+	}
+
+	// The labeling is stable after at most one round per neuron
+	for i := 0; i < len(org.neurons); i++ {
+		in := make(map[neuronID][]uint64)
+		out := make(map[neuronID][]uint64)
+		for _, s := range enabled {
+			out[s.in] = append(out[s.in], labels[s.out])
+			in[s.out] = append(in[s.out], labels[s.in])
+		}
+
+		refined := make(map[neuronID]uint64)
+		for id := range org.neurons {
+			sort.Slice(in[id], func(a, b int) bool { return in[id][a] < in[id][b] })
+			sort.Slice(out[id], func(a, b int) bool { return out[id][a] < out[id][b] })
+			refined[id] = label(fmt.Sprint(labels[id], in[id], out[id]))
+		}
+
+		stable := distinct(refined) == distinct(labels)
+		labels = refined
+		if stable {
+			break
+		}
+	}
+
+	return labels
+}
+
+// The synapse graph in compressed sparse row form. Every neuron is a row,
+// the rows are in topological order and a row holds the synapses sent by
+// the neuron in the order they were added. Unlike connections the
+// whole graph is stored in two slices.
+type csrGraph struct {
+	// The neuron of each row
+	neurons []neuronID
+	// The row of each neuron
+	index map[neuronID]int
+	// The synapses of row i are colIdx[rowPtr[i]:rowPtr[i+1]]
+	rowPtr []int
+	colIdx []synapseID
+}
+
+// Build the compressed sparse row form of the synapse graph
+func (org *organism) buildCSR() csrGraph {
+	g := csrGraph{
+		neurons: make([]neuronID, 0, len(org.neurons)),
+		index:   make(map[neuronID]int, len(org.neurons)),
+		rowPtr:  make([]int, 1, len(org.neurons)+1),
+		colIdx:  make([]synapseID, 0, len(org.synapses)),
+	}
+
+	order, _ := org.topologicalOrder()
+	g.neurons = append(g.neurons, order...)
+
+	for row, id := range g.neurons {
+		g.index[id] = row
+		g.colIdx = append(g.colIdx, org.connections[id]...)
+		g.rowPtr = append(g.rowPtr, len(g.colIdx))
+	}
+
+	return g
+}
+
+// The neurons in an order where every neuron comes after the senders of its
+// enabled feedforward synapses, and the recurrent synapses. The order is
+// cached until the topology changes.
+func (org *organism) topologicalOrder() ([]neuronID, map[synapseID]bool) {
+	if org.topoOrder != nil && !org.topoDirty {
+		return org.topoOrder, org.topoRecurrent
+	}
+
+	recurrent := org.recurrentSynapses()
+
+	// The number of feedforward synapses into each neuron
+	pending := make(map[neuronID]int)
+	for id, s := range org.synapses {
+		if s.enabled && !recurrent[id] {
+			pending[s.out]++
+		}
+	}
+
+	// Start from the neurons without inputs in gene order
+	order := make([]neuronID, 0, len(org.neurons))
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok && pending[n.id] == 0 {
+			order = append(order, n.id)
+		}
+	}
+
+	for i := 0; i < len(order); i++ {
+		for _, sid := range org.connections[order[i]] {
+			s := org.synapses[sid]
+			if !s.enabled || recurrent[sid] {
+				continue
+			}
+
+			pending[s.out]--
+			if pending[s.out] == 0 {
+				order = append(order, s.out)
+			}
+		}
+	}
+
+	org.topoOrder = order
+	org.topoRecurrent = recurrent
+	org.topoDirty = false
+	org.csr = nil
+
+	return order, recurrent
+}
+
+// The order in which process activates the neurons for a single input.
+// Feedforward networks are evaluated in topological order. Recurrent
+// networks are traversed breadth first from the sensors, the order is the
+// same at every input step and neurons the traversal doesn't reach are
+// left out.
+func (org *organism) EvaluationOrder() []neuronID {
+	order, recurrent := org.topologicalOrder()
+	if len(recurrent) == 0 {
+		return append([]neuronID(nil), order...)
+	}
+
+	seen := make(map[neuronID]bool)
+	queue := make([]neuronID, 0, len(org.neurons))
+	for _, id := range org.sensors {
+		seen[id] = true
+		queue = append(queue, id)
+	}
+
+	for i := 0; i < len(queue); i++ {
+		for _, sid := range org.connections[queue[i]] {
+			s := org.synapses[sid]
+			if s.enabled && !seen[s.out] {
+				seen[s.out] = true
+				queue = append(queue, s.out)
+			}
+		}
+	}
+
+	return queue
+}
+
+// The neurons, sensors excepted, without any enabled synapse into them in
+// gene order. They never receive a signal.
+func (org *organism) DanglingInputNeurons() []neuronID {
+	fed := make(map[neuronID]bool)
+	for _, s := range org.synapses {
+		if s.enabled {
+			fed[s.out] = true
+		}
+	}
+
+	var dangling []neuronID
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok && n.kind != sensorNeuron && !fed[n.id] {
+			dangling = append(dangling, n.id)
+		}
+	}
+
+	return dangling
+}
+
+// The neurons, outputs excepted, without any enabled synapse out of them
+// in gene order. They never contribute to the output.
+func (org *organism) DanglingOutputNeurons() []neuronID {
+	sends := make(map[neuronID]bool)
+	for _, s := range org.synapses {
+		if s.enabled {
+			sends[s.in] = true
+		}
+	}
+
+	var dangling []neuronID
+	for _, g := range org.genes {
+		if n, ok := g.(*neuron); ok && n.kind != outputNeuron && !sends[n.id] {
+			dangling = append(dangling, n.id)
+		}
+	}
+
+	return dangling
+}
+
+// Remove the hidden neurons that never receive a signal or never pass one
+// on, until there are none left since removing a neuron can leave others
+// dangling. Locked neurons are kept. Returns the number of neurons removed.
+func (org *organism) PruneDeadNeurons() int {
+	removed := 0
+	for {
+		dead := append(org.DanglingInputNeurons(), org.DanglingOutputNeurons()...)
+
+		pruned := false
+		for _, id := range dead {
+			n := org.neurons[id]
+			if n == nil || n.kind != hiddenNeuron || n.locked {
+				continue
+			}
+
+			org.removeNeuron(id)
+			removed++
+			pruned = true
+		}
+
+		if !pruned {
+			return removed
+		}
+	}
+}
+
+// The connectivity of a network, only enabled synapses are counted
+type ConnectivityStats struct {
+	// The ratio of enabled synapses to possible synapses
+	Density float64
+
+	// The number of synapses into and out of each neuron
+	FanIn  map[neuronID]int
+	FanOut map[neuronID]int
+
+	// The number of neurons with each fan-in and fan-out, e.g.
+	// FanInDistribution[2] neurons have two synapses into them
+	FanInDistribution  []int
+	FanOutDistribution []int
+}
+
+// The connection density and the fan-in and fan-out of the neurons
+func (org *organism) ConnectivityStats() ConnectivityStats {
+	stats := ConnectivityStats{
+		Density: org.ConnectionDensity(),
+		FanIn:   make(map[neuronID]int, len(org.neurons)),
+		FanOut:  make(map[neuronID]int, len(org.neurons)),
+	}
+
+	for id := range org.neurons {
+		stats.FanIn[id] = 0
+		stats.FanOut[id] = 0
+	}
+
+	for _, s := range org.synapses {
+		if s.enabled {
+			stats.FanIn[s.out]++
+			stats.FanOut[s.in]++
+		}
+	}
+
+	distribution := func(fan map[neuronID]int) []int {
+		var result []int
+		for _, n := range fan {
+			for len(result) <= n {
+				result = append(result, 0)
+			}
+			result[n]++
+		}
+		return result
+	}
+	stats.FanInDistribution = distribution(stats.FanIn)
+	stats.FanOutDistribution = distribution(stats.FanOut)
+
+	return stats
+}
@@ -0,0 +1,377 @@
+package neat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecurrentSynapses(t *testing.T) {
+	org := createSimpleRecurrent()
+	recurrent := org.recurrentSynapses()
+
+	// Only the synapse from the hidden neuron back to the sensor closes a
+	// cycle
+	require.Equal(t, 1, len(recurrent), "")
+	for id := range recurrent {
+		in, out := org.synapseEndpoints(id)
+		require.Equal(t, hiddenNeuron, in.kind, "")
+		require.Equal(t, sensorNeuron, out.kind, "")
+	}
+}
+
+func TestDepth(t *testing.T) {
+	require.Equal(t, 1, newOrganism(2, 2).depth(), "")
+	require.Equal(t, 2, createSimpleRecurrent().depth(), "")
+
+	// Splitting the only synapse adds a layer
+	org := newOrganism(1, 1)
+	org.splitSynapse(org.genes[2].(*synapse).id)
+	require.Equal(t, 2, org.depth(), "")
+}
+
+func TestLayers(t *testing.T) {
+	org := newOrganism(2, 1)
+	sensors, output := org.sensors, org.outputs[0]
+	// Split the synapse from the second sensor, which then connects to the
+	// output through a hidden neuron
+	org.splitSynapse(org.connections[sensors[1]][0])
+	hidden := org.genes[len(org.genes)-3].(*neuron).id
+
+	require.Equal(t, [][]neuronID{sensors, {hidden}, {output}}, org.layers(), "")
+}
+
+func TestWeightMatrices(t *testing.T) {
+	org := newOrganism(2, 1)
+	sensors, output := org.sensors, org.outputs[0]
+	org.splitSynapse(org.connections[sensors[1]][0])
+	hidden := org.genes[len(org.genes)-3].(*neuron).id
+
+	for i, g := range org.genes {
+		if s, ok := g.(*synapse); ok {
+			s.weight = float64(i)
+		}
+	}
+
+	matrices := org.WeightMatrices()
+	require.Equal(t, 2, len(matrices), "")
+
+	// The sensors to the hidden neuron
+	require.Equal(t, 1, matrices[0].Rows, "")
+	require.Equal(t, 2, matrices[0].Cols, "")
+	require.Equal(t, []float64{0, org.synapses[org.connections[sensors[1]][1]].weight}, matrices[0].Data, "")
+
+	// The sensors and the hidden neuron to the output, the direct synapse
+	// from the first sensor skips the hidden layer
+	require.Equal(t, 1, matrices[1].Rows, "")
+	require.Equal(t, 3, matrices[1].Cols, "")
+	require.Equal(t, []neuronID{sensors[0], sensors[1], hidden}, matrices[1].ColNeurons, "")
+	require.Equal(t, []float64{
+		org.synapses[org.connections[sensors[0]][0]].weight,
+		0,
+		org.synapses[org.connections[hidden][0]].weight,
+	}, matrices[1].Data, "")
+	require.Equal(t, []neuronID{output}, matrices[1].RowNeurons, "")
+
+	// A recurrent network is a single adjacency matrix
+	matrices = createSimpleRecurrent().WeightMatrices()
+	require.Equal(t, 1, len(matrices), "")
+	require.Equal(t, 3, matrices[0].Rows, "")
+	require.Equal(t, 3, matrices[0].Cols, "")
+	require.Equal(t, []float64{
+		0, 1, 0,
+		1, 0, 0,
+		0, 1, 0,
+	}, matrices[0].Data, "")
+}
+
+// Create an organism with a sensor feeding an output through two hidden
+// neurons with the given weights, the hidden neurons are added in the given
+// order
+func createDiamond(weights [2]float64, order [2]int) *organism {
+	org := _newOrganism(1, 1)
+
+	sensor := newSensorNeuron()
+	output := newOutputNeuron()
+	hidden := [2]*neuron{newHiddenNeuron(), newHiddenNeuron()}
+
+	org.addNeuron(sensor)
+	org.addNeuron(output)
+	for _, i := range order {
+		org.addNeuron(hidden[i])
+	}
+
+	for _, i := range order {
+		in := newSynapse(sensor, hidden[i])
+		in.weight = weights[i]
+		org.addSynapse(in)
+		org.addSynapse(newSynapse(hidden[i], output))
+	}
+
+	return org
+}
+
+func TestIsomorphicOrganisms(t *testing.T) {
+	a := createDiamond([2]float64{0.5, -1}, [2]int{0, 1})
+	b := createDiamond([2]float64{0.5, -1}, [2]int{1, 0})
+	require.True(t, IsomorphicOrganisms(a, b), "")
+	require.True(t, IsomorphicOrganisms(b, a), "")
+	require.True(t, IsomorphicOrganisms(a, a.clone()), "")
+
+	// Different weights
+	c := createDiamond([2]float64{0.5, 1}, [2]int{0, 1})
+	require.False(t, IsomorphicOrganisms(a, c), "")
+
+	// Different structure, same number of neurons and synapses
+	d := _newOrganism(1, 1)
+	sensor, output := newSensorNeuron(), newOutputNeuron()
+	h0, h1 := newHiddenNeuron(), newHiddenNeuron()
+	for _, n := range []*neuron{sensor, output, h0, h1} {
+		d.addNeuron(n)
+	}
+	in := newSynapse(sensor, h0)
+	in.weight = 0.5
+	chain := newSynapse(h0, h1)
+	chain.weight = -1
+	for _, s := range []*synapse{in, chain, newSynapse(h0, output), newSynapse(h1, output)} {
+		d.addSynapse(s)
+	}
+	require.False(t, IsomorphicOrganisms(a, d), "")
+
+	// A disabled synapse is not part of the network
+	e := a.clone()
+	e.toggleEnabled(e.genes[len(e.genes)-1].(*synapse).id)
+	require.False(t, IsomorphicOrganisms(a, e), "")
+
+	require.False(t, IsomorphicOrganisms(newOrganism(1, 1), newOrganism(1, 2)), "")
+}
+
+func TestStructuralHash(t *testing.T) {
+	// Two sensors, two hidden neurons in a chain, one output and a
+	// recurrent synapse from the output back to the first hidden neuron,
+	// with the hidden neurons and synapses added in the given orders
+	build := func(hiddenOrder [2]int, synapseOrder []int) *organism {
+		org := _newOrganism(2, 1)
+		s0, s1, output := newSensorNeuron(), newSensorNeuron(), newOutputNeuron()
+		hidden := [2]*neuron{newHiddenNeuron(), newHiddenNeuron()}
+		for _, n := range []*neuron{s0, s1, output, hidden[hiddenOrder[0]], hidden[hiddenOrder[1]]} {
+			org.addNeuron(n)
+		}
+
+		pairs := [][2]*neuron{
+			{s0, hidden[0]}, {s1, hidden[0]}, {hidden[0], hidden[1]},
+			{hidden[1], output}, {s1, output}, {output, hidden[0]},
+		}
+		for _, i := range synapseOrder {
+			org.addSynapse(newSynapse(pairs[i][0], pairs[i][1]))
+		}
+
+		return org
+	}
+
+	a := build([2]int{0, 1}, []int{0, 1, 2, 3, 4, 5})
+	b := build([2]int{1, 0}, []int{5, 3, 1, 4, 2, 0})
+	require.Equal(t, a.StructuralHash(), b.StructuralHash(), "")
+	require.NotEqual(t, a.topologyHash(), b.topologyHash(), "")
+
+	// Weights don't count
+	for _, s := range b.synapses {
+		s.weight = 0.5
+	}
+	require.Equal(t, a.StructuralHash(), b.StructuralHash(), "")
+
+	// A disabled synapse is not part of the structure
+	b.toggleEnabled(b.genes[len(b.genes)-1].(*synapse).id)
+	require.NotEqual(t, a.StructuralHash(), b.StructuralHash(), "")
+
+	// The order of the sensors does count
+	c := build([2]int{0, 1}, []int{0, 1, 2, 3, 4, 5})
+	c.sensors[0], c.sensors[1] = c.sensors[1], c.sensors[0]
+	require.NotEqual(t, a.StructuralHash(), c.StructuralHash(), "")
+
+	// The diamond is symmetric
+	require.Equal(t,
+		createDiamond([2]float64{0.5, -1}, [2]int{0, 1}).StructuralHash(),
+		createDiamond([2]float64{1, 1}, [2]int{1, 0}).StructuralHash(), "")
+}
+
+func TestTopologicalOrderCache(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.Equal(t, []float64{2}, org.processFeedforward([]float64{1, 1}), "")
+
+	order, _ := org.topologicalOrder()
+	require.Equal(t, 3, len(order), "")
+	require.False(t, org.topoDirty, "")
+
+	// Splitting adds a neuron that must be evaluated before the output
+	first := org.connections[org.sensors[0]][0]
+	org.splitSynapse(first)
+	require.True(t, org.topoDirty, "")
+	hidden := org.genes[len(org.genes)-3].(*neuron)
+	org.synapses[org.connections[hidden.id][0]].weight = 3
+
+	require.Equal(t, []float64{4}, org.processFeedforward([]float64{1, 1}), "")
+	order, _ = org.topologicalOrder()
+	require.Equal(t, 4, len(order), "")
+
+	// Re-enabling the split synapse adds a skip connection
+	org.toggleEnabled(first)
+	require.True(t, org.topoDirty, "")
+	require.Equal(t, []float64{5}, org.processFeedforward([]float64{1, 1}), "")
+
+	// A recurrent network feeds the recurrent signals to the next input
+	org = createSimpleRecurrent()
+	for _, io := range [][2]float64{{1, 1}, {0, 1}, {0, 1}, {1, 2}} {
+		require.Equal(t, []float64{io[1]}, org.processFeedforward([]float64{io[0]}), "")
+	}
+}
+
+func TestProcessFeedforwardOnly(t *testing.T) {
+	recurrent := createSimpleRecurrent()
+	feedforward := recurrent.clone()
+
+	process := func(org *organism, input float64) []float64 {
+		out, err := org.ProcessFeedforwardOnly([]float64{input})
+		require.NoError(t, err, "")
+		return out
+	}
+
+	// Before any recurrent signal has arrived the two agree
+	require.Equal(t, recurrent.processFeedforward([]float64{1}), process(feedforward, 1), "")
+
+	// From then on the recurrent synapse is ignored
+	require.Equal(t, []float64{1}, recurrent.processFeedforward([]float64{0}), "")
+	require.Equal(t, []float64{0}, process(feedforward, 0), "")
+
+	// and nothing carries over from the recurrent evaluation either
+	require.Equal(t, []float64{1}, process(recurrent, 1), "")
+
+	// The number of inputs must match
+	_, err := feedforward.ProcessFeedforwardOnly([]float64{1, 2})
+	require.Error(t, err, "")
+}
+
+func TestEvaluationOrder(t *testing.T) {
+	org := createSimpleRecurrent()
+	rank := make(map[neuronKind]int)
+	for i, id := range org.EvaluationOrder() {
+		rank[org.neurons[id].kind] = i
+	}
+
+	require.Equal(t, 3, len(rank), "")
+	require.True(t, rank[sensorNeuron] < rank[hiddenNeuron], "")
+	require.True(t, rank[hiddenNeuron] < rank[outputNeuron], "")
+
+	// Feedforward networks are evaluated in topological order
+	org = createFeedforwardOrganism(2, 2, 3)
+	order, _ := org.topologicalOrder()
+	require.Equal(t, order, org.EvaluationOrder(), "")
+}
+
+func TestDanglingInputNeurons(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.Equal(t, 0, len(org.DanglingInputNeurons()), "")
+
+	org.splitSynapse(org.connections[org.sensors[0]][0])
+	hidden := org.genes[len(org.genes)-3].(*neuron).id
+	require.Equal(t, 0, len(org.DanglingInputNeurons()), "")
+
+	// Disable the synapse into the hidden neuron
+	for _, s := range org.synapses {
+		if s.out == hidden {
+			org.toggleEnabled(s.id)
+		}
+	}
+	require.Equal(t, []neuronID{hidden}, org.DanglingInputNeurons(), "")
+
+	// Sensors never dangle, an output without enabled synapses does
+	for _, s := range org.synapses {
+		s.enabled = false
+	}
+	require.Equal(t, []neuronID{org.outputs[0], hidden}, org.DanglingInputNeurons(), "")
+}
+
+func TestDanglingOutputNeurons(t *testing.T) {
+	org := newOrganism(2, 1)
+	require.Equal(t, 0, len(org.DanglingOutputNeurons()), "")
+
+	org.splitSynapse(org.connections[org.sensors[0]][0])
+	hidden := org.genes[len(org.genes)-3].(*neuron).id
+	require.Equal(t, 0, len(org.DanglingOutputNeurons()), "")
+
+	// Disable the synapse out of the hidden neuron, the output never has
+	// any synapses out of it
+	for _, id := range org.connections[hidden] {
+		org.toggleEnabled(id)
+	}
+	require.Equal(t, []neuronID{hidden}, org.DanglingOutputNeurons(), "")
+}
+
+func TestConnectivityStats(t *testing.T) {
+	org := createDiamond([2]float64{1, 1}, [2]int{0, 1})
+	sensor, output := org.sensors[0], org.outputs[0]
+
+	stats := org.ConnectivityStats()
+	require.InDelta(t, 4.0/12, stats.Density, 1e-9, "")
+	require.Equal(t, 0, stats.FanIn[sensor], "")
+	require.Equal(t, 2, stats.FanIn[output], "")
+	require.Equal(t, 2, stats.FanOut[sensor], "")
+	require.Equal(t, 0, stats.FanOut[output], "")
+	require.Equal(t, []int{1, 2, 1}, stats.FanInDistribution, "")
+	require.Equal(t, []int{1, 2, 1}, stats.FanOutDistribution, "")
+
+	// Disabled synapses don't count
+	org.toggleEnabled(org.connections[sensor][0])
+	stats = org.ConnectivityStats()
+	require.InDelta(t, 3.0/12, stats.Density, 1e-9, "")
+	require.Equal(t, 1, stats.FanOut[sensor], "")
+	require.Equal(t, []int{2, 1, 1}, stats.FanInDistribution, "")
+	require.Equal(t, []int{1, 3}, stats.FanOutDistribution, "")
+}
+
+func TestPruneDeadNeurons(t *testing.T) {
+	// sensor -> A -> B -> C -> D -> output, A is also connected to the
+	// output
+	org := _newOrganism(1, 1)
+	sensor := newSensorNeuron()
+	output := newOutputNeuron()
+	org.addNeuron(sensor)
+	org.addNeuron(output)
+
+	chain := []*neuron{sensor}
+	for i := 0; i < 4; i++ {
+		n := newHiddenNeuron()
+		org.addNeuron(n)
+		chain = append(chain, n)
+	}
+	chain = append(chain, output)
+
+	var synapses []*synapse
+	for i := 0; i+1 < len(chain); i++ {
+		s := newSynapse(chain[i], chain[i+1])
+		org.addSynapse(s)
+		synapses = append(synapses, s)
+	}
+	org.addSynapse(newSynapse(chain[1], output))
+
+	require.Equal(t, 0, org.PruneDeadNeurons(), "")
+
+	// Disabling A -> B leaves B, C and D dead
+	org.toggleEnabled(synapses[1].id)
+	require.Equal(t, 3, org.PruneDeadNeurons(), "")
+	require.Equal(t, 3, len(org.neurons), "")
+	require.Equal(t, 2, len(org.synapses), "")
+	require.Equal(t, 5, len(org.genes), "")
+	require.NotNil(t, org.neurons[chain[1].id], "")
+	for _, n := range chain[2:5] {
+		require.Nil(t, org.neurons[n.id], "")
+	}
+	require.Equal(t, []float64{1}, org.process([]float64{1}), "")
+
+	// Locked neurons are kept
+	org.LockGene(chain[1].innovation)
+	for _, s := range org.synapses {
+		s.enabled = false
+	}
+	require.Equal(t, 0, org.PruneDeadNeurons(), "")
+}
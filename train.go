@@ -0,0 +1,41 @@
+package neat
+
+// The state of a training run after a generation
+type TrainingProgress struct {
+	Generation  int
+	BestFitness float64
+	MeanFitness float64
+	NumSpecies  int
+}
+
+// Evolve a new population under the given configuration for maxGen
+// generations and return the fittest organism. The progress is sent to the
+// progress channel, if not nil, after every generation. Progress reports
+// are dropped rather than blocking training when the channel is full.
+func Train(cfg NeatConfig, nInputs, nOutputs int, eval func(*organism) float64, maxGen int, progress chan<- TrainingProgress) *organism {
+	SetNeatConfig(cfg)
+
+	p := NewPopulation(nInputs, nOutputs, PopulationOptions{})
+	for i := 0; i < maxGen; i++ {
+		p.Step(eval)
+
+		if progress == nil {
+			continue
+		}
+
+		stats := p.stats()
+		report := TrainingProgress{
+			Generation:  stats.Generation,
+			BestFitness: stats.MaxFitness,
+			MeanFitness: stats.MeanFitness,
+			NumSpecies:  stats.NumSpecies,
+		}
+
+		select {
+		case progress <- report:
+		default:
+		}
+	}
+
+	return p.Champion()
+}
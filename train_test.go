@@ -0,0 +1,35 @@
+package neat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrain(t *testing.T) {
+	withSeed(t, 1)
+	t.Cleanup(func() { SetNeatConfig(testConfig) })
+
+	cfg := testConfig
+	cfg.PopulationConfig.Size = 10
+
+	progress := make(chan TrainingProgress, 10)
+	champion := Train(cfg, 1, 1, weightSensitiveEval, 3, progress)
+	close(progress)
+
+	var reports []TrainingProgress
+	for report := range progress {
+		reports = append(reports, report)
+	}
+
+	require.Equal(t, 3, len(reports), "")
+	for i, report := range reports {
+		require.Equal(t, i+1, report.Generation, "")
+		require.True(t, report.MeanFitness <= report.BestFitness, "")
+		require.True(t, report.NumSpecies > 0, "")
+		if i > 0 {
+			require.True(t, report.BestFitness >= reports[i-1].BestFitness, "")
+		}
+	}
+	require.Equal(t, reports[2].BestFitness, champion.fitness, "")
+}
@@ -3,6 +3,9 @@ package neat
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
 )
 
 type Queue interface {
@@ -61,3 +64,44 @@ func max(a, b int) int {
 func inRange(x, lower, upper float64) bool {
 	return lower <= x && x <= upper 
 }
+
+// Is RandFloat64 the generator of the rand package, which is safe for
+// concurrent use
+func randIsShared() bool {
+	return reflect.ValueOf(RandFloat64).Pointer() == reflect.ValueOf(rand.Float64).Pointer()
+}
+
+// A random integer in the range [0, n) drawn using RandFloat64
+func randIntn(n int) int {
+	return min(int(RandFloat64()*float64(n)), n-1)
+}
+
+// A normally distributed random number with mean 0 and standard deviation
+// 1 drawn using RandFloat64
+func randNormFloat64() float64 {
+	// Box-Muller, 1 - u keeps the logarithm finite
+	u := 1 - RandFloat64()
+	v := RandFloat64()
+	return math.Sqrt(-2*math.Log(u)) * math.Cos(2*math.Pi*v)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// The index of the largest value, ties are broken by the lowest index. -1
+// if there are no values.
+func Argmax(values []float64) int {
+	best := -1
+	for i, v := range values {
+		if best == -1 || v > values[best] {
+			best = i
+		}
+	}
+
+	return best
+}
@@ -26,3 +26,13 @@ func TestSQueue(t *testing.T) {
 		t.Error("Wrong size")
 	}
 }
+
+func TestArgmax(t *testing.T) {
+	if i := Argmax([]float64{1, 3, 2, 3}); i != 1 {
+		t.Error("Expected 1 not ", i)
+	}
+
+	if i := Argmax(nil); i != -1 {
+		t.Error("Expected -1 not ", i)
+	}
+}
@@ -0,0 +1,74 @@
+package neat
+
+// A read-only view of an organism, e.g. to monitor the champion of every
+// generation without cloning it. The view can run the network but has no
+// methods that change it.
+type OrganismView interface {
+	// Feed a slice of inputs to the network and return the output
+	Process(input []float64) ([]float64, error)
+
+	// The number of neurons and enabled synapses
+	Complexity() int
+
+	// The network in the Graphviz DOT language
+	ToDOT() string
+
+	// The fitness of the organism
+	Fitness() float64
+}
+
+// The view shares the genes of the organism but keeps its own neuron states,
+// so that running it doesn't disturb the organism
+type organismView struct {
+	org *organism
+}
+
+// A read-only view of the organism. The genes are shared rather than
+// copied, the view reflects the organism as long as the organism lives
+// and must not be used while the organism is changing, e.g. while its
+// population is stepping.
+func (org *organism) View() OrganismView {
+	shallow := &organism{
+		id:          org.id,
+		sensors:     org.sensors,
+		outputs:     org.outputs,
+		neurons:     org.neurons,
+		synapses:    org.synapses,
+		connections: org.connections,
+		incoming:    org.incoming,
+		genes:       org.genes,
+		generation:  org.generation,
+		fitness:     org.fitness,
+		age:         org.age,
+		species:     org.species,
+		topoDirty:   true,
+	}
+
+	return organismView{shallow}
+}
+
+func (v organismView) Process(input []float64) ([]float64, error) {
+	return v.org.Process(input)
+}
+
+func (v organismView) Complexity() int {
+	return v.org.Complexity()
+}
+
+func (v organismView) ToDOT() string {
+	return v.org.ToDOT()
+}
+
+func (v organismView) Fitness() float64 {
+	return v.org.fitness
+}
+
+// A read-only view of the fittest organism, nil if the population is empty
+func (p *Population) ChampionView() OrganismView {
+	champion := p.Champion()
+	if champion == nil {
+		return nil
+	}
+
+	return champion.View()
+}
@@ -0,0 +1,44 @@
+package neat
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganismView(t *testing.T) {
+	withSeed(t, 1)
+
+	org := createRandomOrganism(3, 2, 4, 3)
+	org.fitness = 1.5
+	view := org.View()
+
+	require.Equal(t, 1.5, view.Fitness(), "")
+	require.Equal(t, org.Complexity(), view.Complexity(), "")
+	require.Equal(t, org.ToDOT(), view.ToDOT(), "")
+
+	for _, input := range [][]float64{{1, 0, 0}, {0.5, -1, 2}, {0, 0, 0}} {
+		out, err := view.Process(input)
+		require.NoError(t, err, "")
+		require.Equal(t, org.process(input), out, "")
+	}
+
+	// The view only has the read-only methods
+	var methods []string
+	typ := reflect.TypeOf(view)
+	for i := 0; i < typ.NumMethod(); i++ {
+		methods = append(methods, typ.Method(i).Name)
+	}
+	sort.Strings(methods)
+	require.Equal(t, []string{"Complexity", "Fitness", "Process", "ToDOT"}, methods, "")
+}
+
+func TestChampionView(t *testing.T) {
+	population := newPopulationFrom(1, 1, nil)
+	require.Nil(t, population.ChampionView(), "")
+
+	population = newPopulationFrom(1, 1, createPopulation(1, 3, 2))
+	require.Equal(t, 3.0, population.ChampionView().Fitness(), "")
+}